@@ -12,14 +12,224 @@ type User struct {
     UpdatedAt time.Time `json:"updated_at"`
     Email string `json:"email"`
     IsChirpyRed bool `json:"is_chirpy_red"`
+    EmailVerified bool `json:"email_verified"`
+    Role string `json:"role"`
+    Handle string `json:"handle"`
+    DisplayName string `json:"display_name"`
+    Bio string `json:"bio"`
+    AvatarURL string `json:"avatar_url"`
     Token string `json:"token"`
     RefreshToken string `json:"refresh_token"`
 }
 
+// Profile is the public view of a user. It must never carry the email
+// address or anything else from the account settings.
+type Profile struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    Handle string `json:"handle"`
+    DisplayName string `json:"display_name"`
+    Bio string `json:"bio"`
+    AvatarURL string `json:"avatar_url"`
+    ChirpCount int64 `json:"chirp_count"`
+    FollowerCount int64 `json:"follower_count"`
+    FollowingCount int64 `json:"following_count"`
+}
+
+type Author struct {
+    ID uuid.UUID `json:"id"`
+    Handle string `json:"handle"`
+    DisplayName string `json:"display_name"`
+    AvatarURL string `json:"avatar_url"`
+}
+
 type Chirp struct {
     ID uuid.UUID `json:"id"`
     CreatedAt time.Time `json:"created_at"`
     UpdatedAt time.Time `json:"updated_at"`
     Body string `json:"body"`
     UserID uuid.UUID `json:"user_id"`
+    Author *Author `json:"author,omitempty"`
+    Entities ChirpEntities `json:"entities"`
+    Edited bool `json:"edited"`
+    EditedAt *time.Time `json:"edited_at,omitempty"`
+    ParentID *uuid.UUID `json:"parent_id,omitempty"`
+    RootID *uuid.UUID `json:"root_id,omitempty"`
+    ReplyCount int32 `json:"reply_count"`
+    Deleted bool `json:"deleted"`
+    LikeCount int32 `json:"like_count"`
+    LikedByMe *bool `json:"liked_by_me,omitempty"`
+    RepostOf *uuid.UUID `json:"repost_of,omitempty"`
+    Original *Chirp `json:"original,omitempty"`
+    Media []Media `json:"media"`
+}
+
+// DeletedChirp is the payload of chirp.deleted events.
+type DeletedChirp struct {
+    ID uuid.UUID `json:"id"`
+    UserID uuid.UUID `json:"user_id"`
+}
+
+// TokenRevoked is the payload of token.revoked events. Kind is session,
+// all_sessions or personal_access_token; ID is unset for all_sessions.
+type TokenRevoked struct {
+    UserID uuid.UUID `json:"user_id"`
+    Kind string `json:"kind"`
+    ID *uuid.UUID `json:"id,omitempty"`
+}
+
+// UserUpgraded is the payload of user.upgraded events.
+type UserUpgraded struct {
+    UserID uuid.UUID `json:"user_id"`
+}
+
+type Media struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    ContentType string `json:"content_type"`
+    SizeBytes int32 `json:"size_bytes"`
+    Width int32 `json:"width"`
+    Height int32 `json:"height"`
+    URL string `json:"url"`
+    ThumbnailURL string `json:"thumbnail_url"`
+}
+
+type ChirpEntities struct {
+    Mentions []MentionEntity `json:"mentions"`
+    Hashtags []HashtagEntity `json:"hashtags"`
+}
+
+// MentionEntity and HashtagEntity offsets count Unicode code points into the
+// chirp body, with start on the @ or # and end exclusive.
+type MentionEntity struct {
+    UserID uuid.UUID `json:"user_id"`
+    Handle string `json:"handle"`
+    Start int `json:"start"`
+    End int `json:"end"`
+}
+
+type HashtagEntity struct {
+    Tag string `json:"tag"`
+    Start int `json:"start"`
+    End int `json:"end"`
+}
+
+type TrendingHashtag struct {
+    Tag string `json:"tag"`
+    Score float64 `json:"score"`
+    Uses int32 `json:"uses"`
+    ComputedAt time.Time `json:"computed_at"`
+}
+
+type ChirpThreadNode struct {
+    Chirp
+    Replies []*ChirpThreadNode `json:"replies"`
+}
+
+type ChirpThread struct {
+    Ancestors []Chirp `json:"ancestors"`
+    Chirp *ChirpThreadNode `json:"chirp"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type ChirpRevision struct {
+    ID uuid.UUID `json:"id"`
+    ChirpID uuid.UUID `json:"chirp_id"`
+    Body string `json:"body"`
+    CreatedAt time.Time `json:"created_at"`
+    ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type ChirpPage struct {
+    Chirps []Chirp `json:"chirps"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type UserPage struct {
+    Users []Author `json:"users"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type Follow struct {
+    UserID uuid.UUID `json:"user_id"`
+    Handle string `json:"handle"`
+    FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowPage struct {
+    Users []Follow `json:"users"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type Notification struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    Kind string `json:"kind"`
+    ActorID uuid.UUID `json:"actor_id"`
+    ChirpID *uuid.UUID `json:"chirp_id,omitempty"`
+    Read bool `json:"read"`
+}
+
+type NotificationPage struct {
+    Notifications []Notification `json:"notifications"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type Session struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    ExpiresAt time.Time `json:"expires_at"`
+    UserAgent string `json:"user_agent"`
+    IPAddress string `json:"ip_address"`
+}
+
+// WebhookSubscription includes Secret only in the response that creates it.
+type WebhookSubscription struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    URL string `json:"url"`
+    Events []string `json:"events"`
+    AllUsers bool `json:"all_users"`
+    Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is one event queued for a subscription. NextAttemptAt is
+// set only while the delivery is pending.
+type WebhookDelivery struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    EventType string `json:"event_type"`
+    Status string `json:"status"`
+    Attempts int32 `json:"attempts"`
+    NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+    DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+    AttemptLog []WebhookAttempt `json:"attempt_log"`
+}
+
+// WebhookAttempt has no StatusCode when the receiver never responded.
+type WebhookAttempt struct {
+    AttemptedAt time.Time `json:"attempted_at"`
+    StatusCode *int32 `json:"status_code"`
+    Error string `json:"error,omitempty"`
+    DurationMs int32 `json:"duration_ms"`
+}
+
+type WebhookDeliveryPage struct {
+    Deliveries []WebhookDelivery `json:"deliveries"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type TwoFactorChallenge struct {
+    TwoFactorRequired bool `json:"two_factor_required"`
+    ChallengeToken string `json:"challenge_token"`
+}
+
+type PersonalAccessToken struct {
+    ID uuid.UUID `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+    Name string `json:"name"`
+    Scopes []string `json:"scopes"`
+    ExpiresAt *time.Time `json:"expires_at"`
+    LastUsedAt *time.Time `json:"last_used_at"`
+    Token string `json:"token,omitempty"`
 }
@@ -9,4 +9,6 @@ require (
 	golang.org/x/crypto v0.37.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+require github.com/golang-jwt/jwt/v5 v5.2.2
+
+require golang.org/x/sys v0.32.0 // indirect
@@ -4,16 +4,34 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
-    "sort"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/zulkou/chirpy/internal/auth"
 	"github.com/zulkou/chirpy/internal/database"
+	"github.com/zulkou/chirpy/internal/entities"
+	"github.com/zulkou/chirpy/internal/events"
+	"github.com/zulkou/chirpy/internal/mail"
+	"github.com/zulkou/chirpy/internal/media"
+	"github.com/zulkou/chirpy/internal/pagination"
+	"github.com/zulkou/chirpy/internal/search"
+	"github.com/zulkou/chirpy/internal/stream"
+	"github.com/zulkou/chirpy/internal/webhooks"
 )
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -76,10 +94,144 @@ func (cfg *apiConfig) healthzHandler(w http.ResponseWriter, r *http.Request) {
 }
 }
 
+// inTx runs fn with queries bound to one transaction, which is committed if
+// fn returns nil and rolled back otherwise.
+func (cfg *apiConfig) inTx(fn func(q *database.Queries) error) error {
+    tx, err := cfg.sqlDB.BeginTx(context.Background(), nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = fn(cfg.db.WithTx(tx))
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+    return
+}
+
+type contextKey string
+
+const userIDContextKey contextKey = "userID"
+
+// middlewareRequireRole only lets through requests whose access token belongs
+// to a user who currently has at least role, and stores that user's ID on the
+// request context. Personal access tokens are refused.
+func (cfg *apiConfig) middlewareRequireRole(role auth.Role, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        token, err := auth.GetBearerToken(r.Header)
+        if err != nil {
+            respondWithError(w, http.StatusUnauthorized, "Failed to get token")
+            return
+        }
+
+        if auth.IsPersonalAccessToken(token) {
+            respondWithError(w, http.StatusForbidden, "Personal access tokens cannot be used here")
+            return
+        }
+
+        userID, _, err := auth.ValidateAccessToken(token, cfg.jwtKeys)
+        if err != nil {
+            respondWithError(w, http.StatusUnauthorized, "Token missmatch on validation")
+            return
+        }
+
+        // The role claim is only as fresh as the token, so privileged routes
+        // read the current role instead and a demotion applies immediately.
+        user, err := cfg.db.GetUserByID(context.Background(), userID)
+        if err != nil {
+            respondWithError(w, http.StatusUnauthorized, "User not found")
+            return
+        }
+
+        if !auth.Role(user.Role).AtLeast(role) {
+            respondWithError(w, http.StatusForbidden, "User unauthorized")
+            return
+        }
+
+        ctx := context.WithValue(r.Context(), userIDContextKey, userID)
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+func userIDFromContext(ctx context.Context) uuid.UUID {
+    userID, _ := ctx.Value(userIDContextKey).(uuid.UUID)
+    return userID
+}
+
+// authenticate resolves the bearer token on r to a user, answering with an
+// error and returning false when it cannot. JWT access tokens are accepted
+// everywhere. Personal access tokens must carry scope, and are refused when
+// scope is empty since that marks account-management endpoints.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, bool) {
+    token, err := auth.GetBearerToken(r.Header)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Failed to get token")
+        return uuid.Nil, false
+    }
+
+    if !auth.IsPersonalAccessToken(token) {
+        userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+        if err != nil {
+            respondWithError(w, http.StatusUnauthorized, "Token missmatch on validation")
+            return uuid.Nil, false
+        }
+
+        return userID, true
+    }
+
+    pat, err := cfg.db.GetPersonalAccessTokenByHash(context.Background(), auth.HashToken(token))
+    if err != nil || pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time)) {
+        respondWithError(w, http.StatusUnauthorized, "Access token does not exist, is revoked, or is expired")
+        return uuid.Nil, false
+    }
+
+    if scope == "" {
+        respondWithError(w, http.StatusForbidden, "Personal access tokens cannot be used here")
+        return uuid.Nil, false
+    }
+
+    if !auth.HasScope(pat.Scopes, scope) {
+        respondWithError(w, http.StatusForbidden, fmt.Sprintf("Token is missing the %s scope", scope))
+        return uuid.Nil, false
+    }
+
+    err = cfg.db.TouchPersonalAccessToken(context.Background(), pat.ID)
+    if err != nil {
+        log.Printf("Failed to record use of access token %v: %v", pat.ID, err)
+    }
+
+    return pat.UserID, true
+}
+
+// authenticateOptional is authenticate for endpoints that also serve
+// anonymous readers. Without an Authorization header it returns an invalid
+// NullUUID; a header that fails to authenticate is still rejected.
+func (cfg *apiConfig) authenticateOptional(w http.ResponseWriter, r *http.Request, scope string) (uuid.NullUUID, bool) {
+    if r.Header.Get("Authorization") == "" {
+        return uuid.NullUUID{}, true
+    }
+
+    userID, ok := cfg.authenticate(w, r, scope)
+    if !ok {
+        return uuid.NullUUID{}, false
+    }
+
+    return uuid.NullUUID{UUID: userID, Valid: true}, true
+}
+
 func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request) {
     type reqStruct struct {
         Email string `json:"email"`
         Password string `json:"password"`
+        Handle string `json:"handle"`
     }
 
     decoder := json.NewDecoder(r.Body)
@@ -90,6 +242,25 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
         return
     }
 
+    err = validateEmail(reqData.Email)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if reqData.Handle == "" {
+        reqData.Handle = "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+    }
+    err = validateHandle(reqData.Handle)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if cfg.handleTaken(reqData.Handle, uuid.Nil) {
+        respondWithError(w, http.StatusConflict, "Handle is already taken")
+        return
+    }
+
     hashedPassword, err := auth.HashPassword(reqData.Password)
     if err != nil {
         respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
@@ -99,18 +270,30 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
     resp, err := cfg.db.CreateUser(context.Background(), database.CreateUserParams{
         Email: reqData.Email,
         HashedPassword: hashedPassword,
+        Handle: reqData.Handle,
     })
     if err != nil {
         respondWithError(w, http.StatusInternalServerError, "Failed to create user")
         return
     }
 
+    err = cfg.sendVerificationEmail(resp)
+    if err != nil {
+        log.Printf("Failed to send verification email to user %v: %v", resp.ID, err)
+    }
+
     createdUser := User{
         ID: resp.ID,
         CreatedAt: resp.CreatedAt,
         UpdatedAt: resp.UpdatedAt,
         Email: resp.Email,
         IsChirpyRed: resp.IsChirpyRed,
+        EmailVerified: resp.EmailVerifiedAt.Valid,
+        Role: resp.Role,
+        Handle: resp.Handle,
+        DisplayName: resp.DisplayName,
+        Bio: resp.Bio,
+        AvatarURL: resp.AvatarUrl,
     }
 
     respondWithJSON(w, http.StatusCreated, createdUser)
@@ -118,27 +301,363 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 
 }
 
-func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request) {
-    token, err := auth.GetBearerToken(r.Header)
+// validateEmail accepts a bare address only. It must parse back to exactly
+// what was sent, which also keeps line breaks out of the mail headers.
+func validateEmail(email string) error {
+    addr, err := netmail.ParseAddress(email)
+    if err != nil || addr.Name != "" || addr.Address != email || strings.ContainsAny(email, "\r\n") {
+        return errors.New("Email must be a valid address")
+    }
+
+    return nil
+}
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+func validateHandle(handle string) error {
+    if !handlePattern.MatchString(handle) {
+        return errors.New("Handle must be 3 to 30 letters, digits or underscores")
+    }
+
+    return nil
+}
+
+func validateProfile(profile database.UpdateUserProfileParams) error {
+    err := validateHandle(profile.Handle)
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Failed to get token")
+        return err
+    }
+
+    if utf8.RuneCountInString(profile.DisplayName) > 50 {
+        return errors.New("Display name is too long")
+    }
+    if utf8.RuneCountInString(profile.Bio) > 160 {
+        return errors.New("Bio is too long")
+    }
+
+    if profile.AvatarUrl != "" {
+        avatarURL, err := url.Parse(profile.AvatarUrl)
+        if err != nil || (avatarURL.Scheme != "https" && avatarURL.Scheme != "http") || avatarURL.Host == "" || len(profile.AvatarUrl) > 2048 {
+            return errors.New("Avatar URL must be an absolute http or https URL")
+        }
+    }
+
+    return nil
+}
+
+// handleTaken reports whether someone other than userID already uses handle.
+// Handles are unique regardless of case.
+func (cfg *apiConfig) handleTaken(handle string, userID uuid.UUID) bool {
+    user, err := cfg.db.GetUserByHandle(context.Background(), handle)
+    return err == nil && user.ID != userID
+}
+
+func (cfg *apiConfig) getProfileHandler(w http.ResponseWriter, r *http.Request) {
+    handle := r.PathValue("handle")
+
+    var user database.User
+    var err error
+    if userID, parseErr := uuid.Parse(handle); parseErr == nil {
+        user, err = cfg.db.GetUserByID(context.Background(), userID)
+    } else {
+        user, err = cfg.db.GetUserByHandle(context.Background(), handle)
+    }
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    counts, err := cfg.db.GetProfileCounts(context.Background(), user.ID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch profile")
+        return
+    }
+
+    profile := Profile{
+        ID: user.ID,
+        CreatedAt: user.CreatedAt,
+        Handle: user.Handle,
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarURL: user.AvatarUrl,
+        ChirpCount: counts.ChirpCount,
+        FollowerCount: counts.FollowerCount,
+        FollowingCount: counts.FollowingCount,
+    }
+
+    respondWithJSON(w, http.StatusOK, profile)
+    return
+}
+
+// sendVerificationEmail records a new single-use verification token for user
+// and mails it to their current address.
+func (cfg *apiConfig) sendVerificationEmail(user database.User) error {
+    verification, err := cfg.db.CreateEmailVerification(context.Background(), database.CreateEmailVerificationParams{
+        ID: uuid.New(),
+        UserID: user.ID,
+        ExpiresAt: time.Now().Add(24 * time.Hour),
+        Email: user.Email,
+    })
+    if err != nil {
+        return err
+    }
+
+    token, err := auth.MakeEmailVerificationToken(user.ID, verification.ID, cfg.jwtKeys, 24 * time.Hour)
+    if err != nil {
+        return err
+    }
+
+    return cfg.mailer.Send(context.Background(), mail.Message{
+        To: user.Email,
+        Subject: "Verify your Chirpy email address",
+        Body: fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by sending this token to POST /api/users/verify within 24 hours:\n\n%s\n", token),
+    })
+}
+
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+    type reqStruct struct {
+        Token string `json:"token"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    userID, tokenID, err := auth.ValidateEmailVerificationToken(reqData.Token, cfg.jwtKeys)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Invalid verification token")
+        return
+    }
+
+    email, err := cfg.db.UseEmailVerification(context.Background(), database.UseEmailVerificationParams{
+        ID: tokenID,
+        UserID: userID,
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        respondWithError(w, http.StatusUnauthorized, "Verification token was already used or has expired")
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+        return
+    }
+
+    // The token only proves ownership of the address it was sent to, so it
+    // does nothing once the account has moved to another one.
+    user, err := cfg.db.SetUserEmailVerified(context.Background(), database.SetUserEmailVerifiedParams{
+        ID: userID,
+        Email: email,
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        respondWithError(w, http.StatusUnauthorized, "Verification token is for a different email address")
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+        return
+    }
+
+    // Signing up with BOOTSTRAP_ADMIN_EMAIL proves nothing, so the first
+    // admin is only promoted once they have shown they own the address.
+    if cfg.bootstrapAdminEmail != "" && user.Email == cfg.bootstrapAdminEmail {
+        promoted, err := cfg.db.PromoteBootstrapAdmin(context.Background(), user.Email)
+        if err != nil {
+            log.Printf("Failed to promote bootstrap admin: %v", err)
+        }
+        if promoted > 0 {
+            user.Role = string(auth.RoleAdmin)
+        }
+    }
+
+    verifiedUser := User{
+        ID: user.ID,
+        CreatedAt: user.CreatedAt,
+        UpdatedAt: user.UpdatedAt,
+        Email: user.Email,
+        IsChirpyRed: user.IsChirpyRed,
+        EmailVerified: user.EmailVerifiedAt.Valid,
+        Role: user.Role,
+        Handle: user.Handle,
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarURL: user.AvatarUrl,
+    }
+
+    respondWithJSON(w, http.StatusOK, verifiedUser)
+    return
+}
+
+const (
+    maxMediaBytes = 5 << 20
+    maxChirpMedia = 4
+)
+
+var errMediaUnavailable = errors.New("Media not found or already attached")
+
+// uploadMediaHandler accepts a single image in the "file" field of a
+// multipart form. What gets stored is the re-encoded image, never the
+// upload itself.
+func (cfg *apiConfig) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, auth.ScopeChirpsWrite)
+    if !ok {
+        return
+    }
+
+    // Leave room for the multipart framing around the file.
+    r.Body = http.MaxBytesReader(w, r.Body, maxMediaBytes + (64 << 10))
+    file, _, err := r.FormFile("file")
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            respondWithError(w, http.StatusRequestEntityTooLarge, "Media is too large")
+            return
+        }
+        respondWithError(w, http.StatusBadRequest, "Missing file")
+        return
+    }
+    defer file.Close()
+
+    data, err := io.ReadAll(io.LimitReader(file, maxMediaBytes + 1))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to read file")
+        return
+    }
+    if len(data) > maxMediaBytes {
+        respondWithError(w, http.StatusRequestEntityTooLarge, "Media is too large")
+        return
+    }
+
+    // Decoding takes far more memory than the upload itself, so only a few
+    // images are processed at a time.
+    select {
+    case cfg.mediaSlots <- struct{}{}:
+    case <-r.Context().Done():
+        return
+    }
+    processed, err := media.ProcessImage(data)
+    <-cfg.mediaSlots
+    if errors.Is(err, media.ErrUnsupportedType) {
+        respondWithError(w, http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images are supported")
+        return
+    }
+    if errors.Is(err, media.ErrTooManyPixels) {
+        respondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Invalid image")
         return
     }
 
-    userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+    mediaID := uuid.New()
+    blobKey := mediaID.String() + processed.Ext
+    thumbnailKey := mediaID.String() + "_thumb" + processed.ThumbnailExt
+
+    err = cfg.blobs.Put(context.Background(), blobKey, processed.Data, processed.ContentType)
+    if err != nil {
+        log.Printf("Failed to store media %v: %v", mediaID, err)
+        respondWithError(w, http.StatusInternalServerError, "Failed to store media")
+        return
+    }
+    err = cfg.blobs.Put(context.Background(), thumbnailKey, processed.Thumbnail, processed.ThumbnailContentType)
+    if err != nil {
+        log.Printf("Failed to store thumbnail of media %v: %v", mediaID, err)
+        cfg.deleteBlobs(blobKey)
+        respondWithError(w, http.StatusInternalServerError, "Failed to store media")
+        return
+    }
+
+    attachment, err := cfg.db.CreateMediaAttachment(context.Background(), database.CreateMediaAttachmentParams{
+        ID: mediaID,
+        UserID: userID,
+        ContentType: processed.ContentType,
+        SizeBytes: int32(len(processed.Data)),
+        Width: int32(processed.Width),
+        Height: int32(processed.Height),
+        BlobKey: blobKey,
+        ThumbnailKey: thumbnailKey,
+    })
+    if err != nil {
+        cfg.deleteBlobs(blobKey, thumbnailKey)
+        respondWithError(w, http.StatusInternalServerError, "Failed to save media")
+        return
+    }
+
+    respondWithJSON(w, http.StatusCreated, mediaFromDB(attachment))
+    return
+}
+
+// serveMediaHandler streams a blob. Keys are never reused, so responses can
+// be cached for good and the key doubles as the ETag.
+func (cfg *apiConfig) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+    key := r.PathValue("key")
+    etag := `"` + key + `"`
+
+    w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+    w.Header().Set("ETag", etag)
+    if r.Header.Get("If-None-Match") == etag {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+
+    obj, err := cfg.blobs.Get(r.Context(), key)
+    if errors.Is(err, media.ErrNotFound) {
+        w.Header().Del("Cache-Control")
+        w.Header().Del("ETag")
+        http.NotFound(w, r)
+        return
+    }
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Token missmatch on validation")
+        w.Header().Del("Cache-Control")
+        w.Header().Del("ETag")
+        log.Printf("Failed to fetch blob %s: %v", key, err)
+        http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
+        return
+    }
+    defer obj.Body.Close()
+
+    w.Header().Set("Content-Type", obj.ContentType)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    if obj.Size >= 0 {
+        w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+    }
+    w.WriteHeader(http.StatusOK)
+    io.Copy(w, obj.Body)
+}
+
+func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, auth.ScopeChirpsWrite)
+    if !ok {
         return
     }
 
+    if cfg.requireEmailVerification {
+        user, err := cfg.db.GetUserByID(context.Background(), userID)
+        if err != nil {
+            respondWithError(w, http.StatusUnauthorized, "User not found")
+            return
+        }
+        if !user.EmailVerifiedAt.Valid {
+            respondWithError(w, http.StatusForbidden, "Email address is not verified")
+            return
+        }
+    }
+
     type userChirp struct {
         Body string `json:"body"`
         UserID uuid.UUID `json:"user_id"`
+        InReplyTo *uuid.UUID `json:"in_reply_to"`
+        RepostOf *uuid.UUID `json:"repost_of"`
+        MediaIDs []uuid.UUID `json:"media_ids"`
     }
 
     decoder := json.NewDecoder(r.Body)
     reqData := userChirp{}
-    err = decoder.Decode(&reqData)
+    err := decoder.Decode(&reqData)
     if err != nil {
         respondWithError(w, http.StatusInternalServerError, "Failed to decode user input")
         return
@@ -146,353 +665,3454 @@ func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request)
 
     reqData.UserID = userID
 
-    if len(reqData.Body) > 140 {
-        respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+    knownHandles, err := cfg.mentionedHandles(reqData.Body)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to resolve mentions")
         return
     }
 
-    profanities := map[string]bool{
-        "kerfuffle": true, 
-        "sharbert": true,
-        "fornax": true,
+    res, err := cleanChirpBody(reqData.Body, knownHandles)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if reqData.InReplyTo != nil && reqData.RepostOf != nil {
+        respondWithError(w, http.StatusBadRequest, "A chirp cannot both reply to and repost another chirp")
+        return
+    }
+
+    if len(reqData.MediaIDs) > 0 {
+        if len(reqData.MediaIDs) > maxChirpMedia {
+            respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A chirp can have at most %d media", maxChirpMedia))
+            return
+        }
+        // Media turns a bodyless repost into a quote, which needs a body.
+        if reqData.RepostOf != nil && res == "" {
+            respondWithError(w, http.StatusBadRequest, "A rechirp cannot have media")
+            return
+        }
+
+        var attachments []database.MediaAttachment
+        attachments, err = cfg.db.ListMediaAttachmentsByIDs(context.Background(), reqData.MediaIDs)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to fetch media")
+            return
+        }
+        usable := map[uuid.UUID]bool{}
+        for _, attachment := range attachments {
+            usable[attachment.ID] = attachment.UserID == reqData.UserID && !attachment.ChirpID.Valid
+        }
+        seen := map[uuid.UUID]bool{}
+        for _, mediaID := range reqData.MediaIDs {
+            if !usable[mediaID] || seen[mediaID] {
+                respondWithError(w, http.StatusBadRequest, errMediaUnavailable.Error())
+                return
+            }
+            seen[mediaID] = true
+        }
+    }
+
+    var parentID uuid.UUID
+    var repostOf uuid.NullUUID
+    switch {
+    case reqData.InReplyTo != nil:
+        parent, err := cfg.db.GetChirpByID(context.Background(), *reqData.InReplyTo)
+        if err != nil {
+            respondWithError(w, http.StatusNotFound, "Parent chirp not found")
+            return
+        }
+        // Replies to a rechirp belong to the original conversation.
+        if isRechirp(parent) {
+            parent.ID = parent.RepostOf.UUID
+        }
+        parentID = parent.ID
+    case reqData.RepostOf != nil:
+        original, err := cfg.db.GetChirpByID(context.Background(), *reqData.RepostOf)
+        if err != nil || original.DeletedAt.Valid {
+            respondWithError(w, http.StatusNotFound, "Reposted chirp not found")
+            return
+        }
+        // Sharing a rechirp shares the chirp it points at.
+        if isRechirp(original) {
+            original.ID = original.RepostOf.UUID
+        }
+        repostOf = uuid.NullUUID{UUID: original.ID, Valid: true}
     }
+    rechirp := repostOf.Valid && res == ""
+
+    // The chirp and its media attachments are written together, so a chirp
+    // is never published without the media the client asked for.
+    var resp database.Chirp
+    err = cfg.inTx(func(q *database.Queries) error {
+        var err error
+        switch {
+        case reqData.InReplyTo != nil:
+            resp, err = q.CreateReply(context.Background(), database.CreateReplyParams{
+                ParentID: parentID,
+                Body: res,
+                UserID: reqData.UserID,
+            })
+        case rechirp:
+            resp, err = q.CreateRechirp(context.Background(), database.CreateRechirpParams{
+                UserID: reqData.UserID,
+                RepostOf: repostOf,
+            })
+        default:
+            resp, err = q.CreateChirp(context.Background(), database.CreateChirpParams{
+                Body: res,
+                UserID: reqData.UserID,
+                RepostOf: repostOf,
+            })
+        }
+        if err != nil {
+            return err
+        }
+
+        err = recordMentions(q, resp, false)
+        if err != nil {
+            return err
+        }
+        err = recordHashtags(q, resp, false)
+        if err != nil {
+            return err
+        }
+        if len(reqData.MediaIDs) == 0 {
+            return nil
+        }
+
+        attached, err := q.AttachMedia(context.Background(), database.AttachMediaParams{
+            ChirpID: uuid.NullUUID{UUID: resp.ID, Valid: true},
+            Ids: reqData.MediaIDs,
+            UserID: reqData.UserID,
+        })
+        if err != nil {
+            return err
+        }
+        // Another chirp or the unattached media sweep got there first.
+        if attached != int64(len(reqData.MediaIDs)) {
+            return errMediaUnavailable
+        }
+        return nil
+    })
+    // Rechirping twice returns the rechirp that is already there.
+    if errors.Is(err, sql.ErrNoRows) && rechirp {
+        existing, err := cfg.db.GetRechirp(context.Background(), database.GetRechirpParams{
+            UserID: reqData.UserID,
+            RepostOf: repostOf,
+        })
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to fetch rechirp")
+            return
+        }
+        cfg.respondWithChirp(w, http.StatusOK, reqData.UserID, existing)
+        return
+    }
+    if errors.Is(err, sql.ErrNoRows) {
+        respondWithError(w, http.StatusNotFound, "Parent chirp not found")
+        return
+    }
+    if errors.Is(err, errMediaUnavailable) {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create chirp")
+        return
+    }
+
+    err = cfg.db.FanOutChirp(context.Background(), resp.ID)
+    if err != nil {
+        log.Printf("Failed to fan out chirp %v: %v", resp.ID, err)
+    }
+
+    // Stream subscribers get the chirp as anyone would see it; the author's
+    // response then adds liked_by_me on top.
+    chirps := []Chirp{chirpFromDB(resp)}
+    err = cfg.decorateChirps(uuid.NullUUID{}, chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+        return
+    }
+    cfg.publishEvent(events.ChirpCreated, resp.ID, chirps[0])
+
+    err = cfg.markLikedByViewer(uuid.NullUUID{UUID: reqData.UserID, Valid: true}, chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+        return
+    }
+
+    respondWithJSON(w, http.StatusCreated, chirps[0])
+    return
+}
+
+// publishEvent puts payload on the event bus. id names what the event is
+// about: the chirp for chirp events and the account for the rest. It runs
+// after the change is saved, so failures are only logged.
+func (cfg *apiConfig) publishEvent(eventType string, id uuid.UUID, payload interface{}) {
+    data, err := json.Marshal(payload)
+    if err != nil {
+        log.Printf("Failed to encode %s event: %v", eventType, err)
+        return
+    }
+
+    err = cfg.bus.Publish(context.Background(), events.Event{Type: eventType, ID: id, Payload: data})
+    if err != nil {
+        log.Printf("Failed to publish %s event: %v", eventType, err)
+    }
+
+    cfg.enqueueWebhooks(eventType, data)
+}
+
+// enqueueWebhooks queues a delivery of the event to every subscription that
+// wants it. It is called where the event is published rather than from a bus
+// subscriber so each event is queued once instead of once per instance.
+func (cfg *apiConfig) enqueueWebhooks(eventType string, data []byte) {
+    if !webhooks.ValidEvent(eventType) {
+        return
+    }
+
+    userID, err := eventUserID(data)
+    if err != nil {
+        log.Printf("Failed to decode %s event: %v", eventType, err)
+        return
+    }
+
+    _, err = cfg.db.EnqueueWebhookDeliveries(context.Background(), database.EnqueueWebhookDeliveriesParams{
+        EventType: eventType,
+        Payload: string(data),
+        UserID: userID,
+    })
+    if err != nil {
+        log.Printf("Failed to queue %s webhooks: %v", eventType, err)
+    }
+}
+
+// eventUserID returns the user_id every event payload carries: the author for
+// chirp events and the account itself for the rest.
+func eventUserID(payload []byte) (uuid.UUID, error) {
+    var subject struct {
+        UserID uuid.UUID `json:"user_id"`
+    }
+    err := json.Unmarshal(payload, &subject)
+    return subject.UserID, err
+}
+
+// resolveEvent rebuilds an event another instance sent by reference. Only
+// chirp.created events, which embed quoted chirps and media, grow that large.
+func (cfg *apiConfig) resolveEvent(ctx context.Context, eventType string, id uuid.UUID) (json.RawMessage, error) {
+    if eventType != events.ChirpCreated {
+        return nil, fmt.Errorf("Cannot resolve %s events", eventType)
+    }
+
+    chirp, err := cfg.db.GetChirpByID(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+
+    chirps := []Chirp{chirpFromDB(chirp)}
+    err = cfg.decorateChirps(uuid.NullUUID{}, chirps)
+    if err != nil {
+        return nil, err
+    }
+
+    return json.Marshal(chirps[0])
+}
+
+// streamEvent feeds chirp events from the bus, whichever instance they came
+// from, into this instance's stream hub.
+func (cfg *apiConfig) streamEvent(event events.Event) {
+    if event.Type != events.ChirpCreated && event.Type != events.ChirpDeleted {
+        return
+    }
+
+    authorID, err := eventUserID(event.Payload)
+    if err != nil {
+        log.Printf("Failed to decode %s event: %v", event.Type, err)
+        return
+    }
+
+    cfg.hub.Publish(event.Type, authorID, event.Payload)
+}
+
+// isRechirp reports whether chirp shares another chirp without adding a body
+// of its own. A repost with a body is a quote chirp.
+func isRechirp(chirp database.Chirp) bool {
+    return chirp.RepostOf.Valid && chirp.Body == "" && !chirp.DeletedAt.Valid
+}
+
+const notificationKindMention = "mention"
+
+// recordMentions stores the @mentions in chirp's body and notifies each
+// mentioned user once. After an edit the old mentions are replaced, and
+// users who were already mentioned are not notified again. It writes through
+// q so the mentions commit or roll back with the chirp.
+func recordMentions(q *database.Queries, chirp database.Chirp, edited bool) error {
+    notified := map[uuid.UUID]bool{chirp.UserID: true}
+
+    if edited {
+        previous, err := q.ListMentionsByChirpIDs(context.Background(), []uuid.UUID{chirp.ID})
+        if err != nil {
+            return err
+        }
+        for _, mention := range previous {
+            notified[mention.UserID] = true
+        }
+
+        err = q.DeleteChirpMentions(context.Background(), chirp.ID)
+        if err != nil {
+            return err
+        }
+    }
+
+    mentions := entities.ExtractMentions(chirp.Body)
+    if len(mentions) == 0 {
+        return nil
+    }
+
+    handles := []string{}
+    for _, mention := range mentions {
+        handles = append(handles, strings.ToLower(mention.Handle))
+    }
+
+    users, err := q.ListUsersByHandles(context.Background(), handles)
+    if err != nil {
+        return err
+    }
+
+    byHandle := map[string]uuid.UUID{}
+    for _, user := range users {
+        byHandle[strings.ToLower(user.Handle)] = user.ID
+    }
+
+    for _, mention := range mentions {
+        userID, ok := byHandle[strings.ToLower(mention.Handle)]
+        if !ok {
+            continue
+        }
+
+        err = q.CreateChirpMention(context.Background(), database.CreateChirpMentionParams{
+            ChirpID: chirp.ID,
+            UserID: userID,
+            StartOffset: int32(mention.Start),
+            EndOffset: int32(mention.End),
+        })
+        if err != nil {
+            return err
+        }
+
+        if notified[userID] {
+            continue
+        }
+        notified[userID] = true
+
+        err = q.CreateNotification(context.Background(), database.CreateNotificationParams{
+            UserID: userID,
+            ActorID: chirp.UserID,
+            Kind: notificationKindMention,
+            ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// recordHashtags links chirp to the tags in its body, replacing the old
+// links after an edit. Like recordMentions it writes through q.
+func recordHashtags(q *database.Queries, chirp database.Chirp, edited bool) error {
+    if edited {
+        err := q.DeleteChirpHashtags(context.Background(), chirp.ID)
+        if err != nil {
+            return err
+        }
+    }
+
+    // A tag may only appear once per insert.
+    seen := map[string]bool{}
+    tags := []string{}
+    for _, hashtag := range entities.ExtractHashtags(chirp.Body) {
+        if !seen[hashtag.Tag] {
+            seen[hashtag.Tag] = true
+            tags = append(tags, hashtag.Tag)
+        }
+    }
+    if len(tags) == 0 {
+        return nil
+    }
+
+    return q.TagChirp(context.Background(), database.TagChirpParams{
+        Tags: tags,
+        ChirpID: chirp.ID,
+    })
+}
+
+// respondWithChirp writes a single chirp decorated for the signed-in viewer.
+func (cfg *apiConfig) respondWithChirp(w http.ResponseWriter, code int, viewerID uuid.UUID, chirp database.Chirp) {
+    chirps := []Chirp{chirpFromDB(chirp)}
+
+    err := cfg.decorateChirps(uuid.NullUUID{UUID: viewerID, Valid: true}, chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+        return
+    }
+
+    respondWithJSON(w, code, chirps[0])
+}
+
+// decorateChirps fills in what a chirp response carries beyond its own row:
+// the reposted chirp, the author's public profile, attached media and, for a
+// signed-in viewer, liked_by_me.
+func (cfg *apiConfig) decorateChirps(viewerID uuid.NullUUID, chirps []Chirp) error {
+    err := cfg.embedReposts(chirps)
+    if err != nil {
+        return err
+    }
+
+    err = cfg.embedAuthors(chirps)
+    if err != nil {
+        return err
+    }
+
+    err = cfg.embedMentions(chirps)
+    if err != nil {
+        return err
+    }
+
+    err = cfg.embedMedia(chirps)
+    if err != nil {
+        return err
+    }
+
+    return cfg.markLikedByViewer(viewerID, chirps)
+}
+
+// withOriginals returns pointers to chirps followed by any reposted chirps
+// embedded in them, for the decorations that apply to both.
+func withOriginals(chirps []Chirp) []*Chirp {
+    targets := []*Chirp{}
+    for idx := range chirps {
+        targets = append(targets, &chirps[idx])
+        if chirps[idx].Original != nil {
+            targets = append(targets, chirps[idx].Original)
+        }
+    }
+
+    return targets
+}
+
+// embedAuthors attaches the public profile of each chirp's author, including
+// the authors of embedded reposts.
+func (cfg *apiConfig) embedAuthors(chirps []Chirp) error {
+    targets := withOriginals(chirps)
+    if len(targets) == 0 {
+        return nil
+    }
+
+    authorIDs := []uuid.UUID{}
+    for _, chirp := range targets {
+        authorIDs = append(authorIDs, chirp.UserID)
+    }
+
+    authors, err := cfg.db.ListUsersByIDs(context.Background(), authorIDs)
+    if err != nil {
+        return err
+    }
+
+    byID := map[uuid.UUID]*Author{}
+    for _, author := range authors {
+        byID[author.ID] = &Author{
+            ID: author.ID,
+            Handle: author.Handle,
+            DisplayName: author.DisplayName,
+            AvatarURL: author.AvatarUrl,
+        }
+    }
+
+    for _, chirp := range targets {
+        chirp.Author = byID[chirp.UserID]
+    }
+
+    return nil
+}
+
+// embedMentions fills in entities.mentions from the stored mentions. The
+// handle is read back from the body so it matches what the author typed.
+func (cfg *apiConfig) embedMentions(chirps []Chirp) error {
+    targets := withOriginals(chirps)
+    if len(targets) == 0 {
+        return nil
+    }
+
+    chirpIDs := []uuid.UUID{}
+    for _, chirp := range targets {
+        chirpIDs = append(chirpIDs, chirp.ID)
+    }
+
+    mentions, err := cfg.db.ListMentionsByChirpIDs(context.Background(), chirpIDs)
+    if err != nil {
+        return err
+    }
+
+    byChirp := map[uuid.UUID][]database.ChirpMention{}
+    for _, mention := range mentions {
+        byChirp[mention.ChirpID] = append(byChirp[mention.ChirpID], mention)
+    }
+
+    for _, chirp := range targets {
+        body := []rune(chirp.Body)
+        for _, mention := range byChirp[chirp.ID] {
+            start, end := int(mention.StartOffset), int(mention.EndOffset)
+            if start < 0 || end > len(body) || start + 1 >= end {
+                continue
+            }
+            chirp.Entities.Mentions = append(chirp.Entities.Mentions, MentionEntity{
+                UserID: mention.UserID,
+                Handle: string(body[start+1:end]),
+                Start: start,
+                End: end,
+            })
+        }
+    }
+
+    return nil
+}
+
+// embedMedia attaches the media of each chirp, including embedded reposts, in
+// the order the author attached them.
+func (cfg *apiConfig) embedMedia(chirps []Chirp) error {
+    targets := withOriginals(chirps)
+    if len(targets) == 0 {
+        return nil
+    }
+
+    chirpIDs := []uuid.UUID{}
+    for _, chirp := range targets {
+        chirpIDs = append(chirpIDs, chirp.ID)
+    }
+
+    attachments, err := cfg.db.ListMediaAttachmentsByChirpIDs(context.Background(), chirpIDs)
+    if err != nil {
+        return err
+    }
+
+    byChirp := map[uuid.UUID][]Media{}
+    for _, attachment := range attachments {
+        byChirp[attachment.ChirpID.UUID] = append(byChirp[attachment.ChirpID.UUID], mediaFromDB(attachment))
+    }
+
+    for _, chirp := range targets {
+        if attached, ok := byChirp[chirp.ID]; ok {
+            chirp.Media = attached
+        }
+    }
+
+    return nil
+}
+
+func mediaFromDB(attachment database.MediaAttachment) Media {
+    return Media{
+        ID: attachment.ID,
+        CreatedAt: attachment.CreatedAt,
+        ContentType: attachment.ContentType,
+        SizeBytes: attachment.SizeBytes,
+        Width: attachment.Width,
+        Height: attachment.Height,
+        URL: "/media/" + attachment.BlobKey,
+        ThumbnailURL: "/media/" + attachment.ThumbnailKey,
+    }
+}
+
+// embedReposts attaches the chirp each rechirp or quote points at. Only one
+// level is embedded; a quoted quote still carries its own repost_of id.
+func (cfg *apiConfig) embedReposts(chirps []Chirp) error {
+    repostIDs := []uuid.UUID{}
+    for _, chirp := range chirps {
+        if chirp.RepostOf != nil {
+            repostIDs = append(repostIDs, *chirp.RepostOf)
+        }
+    }
+    if len(repostIDs) == 0 {
+        return nil
+    }
+
+    originals, err := cfg.db.ListChirpsByIDs(context.Background(), repostIDs)
+    if err != nil {
+        return err
+    }
+
+    byID := map[uuid.UUID]database.Chirp{}
+    for _, original := range originals {
+        byID[original.ID] = original
+    }
+
+    for idx := range chirps {
+        if chirps[idx].RepostOf == nil {
+            continue
+        }
+        original, ok := byID[*chirps[idx].RepostOf]
+        if !ok {
+            continue
+        }
+        embedded := chirpFromDB(original)
+        chirps[idx].Original = &embedded
+    }
+
+    return nil
+}
+
+// mentionedHandles returns the lowercased handles mentioned in body that
+// belong to an existing user.
+func (cfg *apiConfig) mentionedHandles(body string) (map[string]bool, error) {
+    known := map[string]bool{}
+
+    handles := []string{}
+    for _, mention := range entities.ExtractMentions(body) {
+        handles = append(handles, strings.ToLower(mention.Handle))
+    }
+    if len(handles) == 0 {
+        return known, nil
+    }
+
+    users, err := cfg.db.ListUsersByHandles(context.Background(), handles)
+    if err != nil {
+        return nil, err
+    }
+    for _, user := range users {
+        known[strings.ToLower(user.Handle)] = true
+    }
+
+    return known, nil
+}
+
+// cleanChirpBody enforces the length limit and masks profanities. Every path
+// that writes a chirp body goes through it.
+func cleanChirpBody(body string, knownHandles map[string]bool) (string, error) {
+    if len(body) > 140 {
+        return "", errors.New("Chirp is too long")
+    }
+
+    profanities := map[string]bool{
+        "kerfuffle": true, 
+        "sharbert": true,
+        "fornax": true,
+    }
+
+    cleanWord := func(word string) string {
+        return strings.TrimFunc(word, func(r rune) bool {
+            return !unicode.IsLetter(r)
+        })
+    }
+
+    words := strings.Split(body, " ")
+    for idx, word := range words {
+        // Mentions of real users are never masked, so they still point at
+        // the user. Anything else after an @ is filtered like any word.
+        mentions := entities.ExtractMentions(word)
+        known := len(mentions) > 0
+        for _, mention := range mentions {
+            known = known && knownHandles[strings.ToLower(mention.Handle)]
+        }
+        if known {
+            continue
+        }
+        lower := cleanWord(strings.ToLower(word)) 
+        if profanities[lower] {
+            words[idx] = "****"
+        }
+    }
+
+    return strings.Join(words, " "), nil
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+    converted := Chirp{
+        ID: chirp.ID,
+        CreatedAt: chirp.CreatedAt,
+        UpdatedAt: chirp.UpdatedAt,
+        Body: chirp.Body,
+        UserID: chirp.UserID,
+        Edited: chirp.EditedAt.Valid,
+        Entities: ChirpEntities{
+            Mentions: []MentionEntity{},
+            Hashtags: []HashtagEntity{},
+        },
+        Media: []Media{},
+        ReplyCount: chirp.ReplyCount,
+        Deleted: chirp.DeletedAt.Valid,
+        LikeCount: chirp.LikeCount,
+    }
+    if chirp.EditedAt.Valid {
+        converted.EditedAt = &chirp.EditedAt.Time
+    }
+    for _, hashtag := range entities.ExtractHashtags(chirp.Body) {
+        converted.Entities.Hashtags = append(converted.Entities.Hashtags, HashtagEntity{
+            Tag: hashtag.Tag,
+            Start: hashtag.Start,
+            End: hashtag.End,
+        })
+    }
+    if chirp.ParentID.Valid {
+        converted.ParentID = &chirp.ParentID.UUID
+    }
+    if chirp.RootID.Valid {
+        converted.RootID = &chirp.RootID.UUID
+    }
+    if chirp.RepostOf.Valid {
+        converted.RepostOf = &chirp.RepostOf.UUID
+    }
+
+    return converted
+}
+
+func (cfg *apiConfig) editChirpHandler(w http.ResponseWriter, r *http.Request) {
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse chirp id")
+        return
+    }
+
+    userID, ok := cfg.authenticate(w, r, auth.ScopeChirpsWrite)
+    if !ok {
+        return
+    }
+
+    chirp, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "Failed to fetch chirp")
+        return
+    }
+
+    if userID != chirp.UserID {
+        respondWithError(w, http.StatusForbidden, "User unauthorized")
+        return
+    }
+
+    if chirp.DeletedAt.Valid {
+        respondWithError(w, http.StatusGone, "Chirp has been deleted")
+        return
+    }
+
+    if isRechirp(chirp) {
+        respondWithError(w, http.StatusBadRequest, "Rechirps cannot be edited")
+        return
+    }
+
+    type reqStruct struct {
+        Body string `json:"body"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err = decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode user input")
+        return
+    }
+
+    knownHandles, err := cfg.mentionedHandles(reqData.Body)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to resolve mentions")
+        return
+    }
+
+    body, err := cleanChirpBody(reqData.Body, knownHandles)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if chirp.RepostOf.Valid && body == "" {
+        respondWithError(w, http.StatusBadRequest, "Quote chirps need a body")
+        return
+    }
+
+    if body == chirp.Body {
+        cfg.respondWithChirp(w, http.StatusOK, userID, chirp)
+        return
+    }
+
+    var edited database.Chirp
+    err = cfg.inTx(func(q *database.Queries) error {
+        var err error
+        edited, err = q.EditChirp(context.Background(), database.EditChirpParams{
+            ID: chirp.ID,
+            Body: body,
+        })
+        if err != nil {
+            return err
+        }
+
+        err = recordMentions(q, edited, true)
+        if err != nil {
+            return err
+        }
+        return recordHashtags(q, edited, true)
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to edit chirp")
+        return
+    }
+
+    cfg.respondWithChirp(w, http.StatusOK, userID, edited)
+    return
+}
+
+func (cfg *apiConfig) getChirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse chirp id")
+        return
+    }
+
+    _, err = cfg.db.GetChirpByID(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, fmt.Sprintf("Failed to fetch chirp with ID: %v", chirpID))
+        return
+    }
+
+    revisions, err := cfg.db.GetChirpRevisions(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch revisions")
+        return
+    }
+
+    revisionsSlice := []ChirpRevision{}
+    for _, revision := range revisions {
+        revisionsSlice = append(revisionsSlice, ChirpRevision{
+            ID: revision.ID,
+            ChirpID: revision.ChirpID,
+            Body: revision.Body,
+            CreatedAt: revision.CreatedAt,
+            ReplacedAt: revision.ReplacedAt,
+        })
+    }
+
+    respondWithJSON(w, http.StatusOK, revisionsSlice)
+    return
+}
+
+func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    authorID := r.URL.Query().Get("author_id")
+    sortQuery := r.URL.Query().Get("sort")
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListChirpsAscParams{
+        // One extra row tells us whether there is a next page.
+        Limit: int32(limit + 1),
+    }
+
+    if authorID != "" {
+        parsedID, err := uuid.Parse(authorID)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, "Failed to parse author id")
+            return
+        }
+        params.AuthorID = uuid.NullUUID{UUID: parsedID, Valid: true}
+    }
+
+    if authorHandle := r.URL.Query().Get("author"); authorHandle != "" {
+        author, err := cfg.db.GetUserByHandle(context.Background(), authorHandle)
+        if err != nil {
+            respondWithError(w, http.StatusNotFound, "Author not found")
+            return
+        }
+        params.AuthorID = uuid.NullUUID{UUID: author.ID, Valid: true}
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    var chirps []database.Chirp
+    switch sortQuery {
+    case "", "asc":
+        chirps, err = cfg.db.ListChirpsAsc(context.Background(), params)
+    case "desc":
+        chirps, err = cfg.db.ListChirpsDesc(context.Background(), database.ListChirpsDescParams(params))
+    default:
+        respondWithError(w, http.StatusBadRequest, "Sort must be asc or desc")
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    page := ChirpPage{
+        Chirps: []Chirp{},
+    }
+    if len(chirps) > limit {
+        chirps = chirps[:limit]
+        last := chirps[len(chirps) - 1]
+        page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    for _, chirp := range chirps {
+        page.Chirps = append(page.Chirps, chirpFromDB(chirp))
+    }
+
+    err = cfg.decorateChirps(viewerID, page.Chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    respondWithJSON(w, http.StatusOK, page)
+    return
+}
+
+func (cfg *apiConfig) getChirpByIDHandler(w http.ResponseWriter, r *http.Request) {
+    stringID := r.PathValue("chirpID")
+    chirpID, err := uuid.Parse(stringID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to parse string into id")
+        return
+    }
+
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    chirpData, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, fmt.Sprintf("Failed to fetch chirp with ID: %v", chirpID))
+        return
+    }
+
+    chirp := []Chirp{chirpFromDB(chirpData)}
+
+    err = cfg.decorateChirps(viewerID, chirp)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    respondWithJSON(w, http.StatusOK, chirp[0])
+    return
+}
+
+// markLikedByViewer fills in LikedByMe for an authenticated viewer and leaves
+// it unset for anonymous requests.
+func (cfg *apiConfig) markLikedByViewer(viewerID uuid.NullUUID, chirps []Chirp) error {
+    if !viewerID.Valid || len(chirps) == 0 {
+        return nil
+    }
+
+    chirpIDs := make([]uuid.UUID, 0, len(chirps))
+    for _, chirp := range chirps {
+        chirpIDs = append(chirpIDs, chirp.ID)
+    }
+
+    likedIDs, err := cfg.db.ListLikedChirpIDs(context.Background(), database.ListLikedChirpIDsParams{
+        UserID: viewerID.UUID,
+        ChirpIds: chirpIDs,
+    })
+    if err != nil {
+        return err
+    }
+
+    liked := map[uuid.UUID]bool{}
+    for _, id := range likedIDs {
+        liked[id] = true
+    }
+
+    for idx := range chirps {
+        likedByMe := liked[chirps[idx].ID]
+        chirps[idx].LikedByMe = &likedByMe
+    }
+
+    return nil
+}
+
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+    cfg.setChirpLike(w, r, true)
+}
+
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+    cfg.setChirpLike(w, r, false)
+}
+
+// setChirpLike backs both like endpoints. Repeating a like or unlike is a
+// no-op, and either way the response carries the chirp's current count.
+func (cfg *apiConfig) setChirpLike(w http.ResponseWriter, r *http.Request, like bool) {
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse chirp id")
+        return
+    }
+
+    userID, ok := cfg.authenticate(w, r, auth.ScopeChirpsWrite)
+    if !ok {
+        return
+    }
+
+    chirp, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+    if err != nil || chirp.DeletedAt.Valid {
+        respondWithError(w, http.StatusNotFound, "Chirp not found")
+        return
+    }
+
+    if like {
+        _, err = cfg.db.LikeChirp(context.Background(), database.LikeChirpParams{
+            ChirpID: chirp.ID,
+            UserID: userID,
+        })
+    } else {
+        _, err = cfg.db.UnlikeChirp(context.Background(), database.UnlikeChirpParams{
+            ChirpID: chirp.ID,
+            UserID: userID,
+        })
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to update like")
+        return
+    }
+
+    chirp, err = cfg.db.GetChirpByID(context.Background(), chirp.ID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+        return
+    }
+
+    updatedChirp := []Chirp{chirpFromDB(chirp)}
+    updatedChirp[0].LikedByMe = &like
+
+    err = cfg.decorateChirps(uuid.NullUUID{}, updatedChirp)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+        return
+    }
+
+    respondWithJSON(w, http.StatusOK, updatedChirp[0])
+    return
+}
+
+func (cfg *apiConfig) getUserLikesHandler(w http.ResponseWriter, r *http.Request) {
+    userID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse user id")
+        return
+    }
+
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListChirpsLikedByUserParams{
+        UserID: userID,
+        Limit: int32(limit + 1),
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    _, err = cfg.db.GetUserByID(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    likes, err := cfg.db.ListChirpsLikedByUser(context.Background(), params)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+        return
+    }
+
+    page := ChirpPage{
+        Chirps: []Chirp{},
+    }
+    if len(likes) > limit {
+        likes = likes[:limit]
+        last := likes[len(likes) - 1]
+        // Likes are paged in the order they were made, not by chirp age.
+        page.NextCursor = pagination.Cursor{CreatedAt: last.LikedAt, ID: last.Chirp.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    for _, like := range likes {
+        page.Chirps = append(page.Chirps, chirpFromDB(like.Chirp))
+    }
+
+    err = cfg.decorateChirps(viewerID, page.Chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    respondWithJSON(w, http.StatusOK, page)
+    return
+}
+
+const (
+    defaultThreadDepth = 3
+    maxThreadDepth = 10
+    // maxThreadReplies caps how many nested replies one thread page loads
+    // below the paginated direct replies.
+    maxThreadReplies = 500
+)
+
+func (cfg *apiConfig) getChirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse chirp id")
+        return
+    }
+
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    depth := defaultThreadDepth
+    if depthQuery := r.URL.Query().Get("depth"); depthQuery != "" {
+        depth, err = strconv.Atoi(depthQuery)
+        if err != nil || depth < 1 || depth > maxThreadDepth {
+            respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Depth must be between 1 and %d", maxThreadDepth))
+            return
+        }
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListRepliesParams{
+        ParentID: chirpID,
+        Limit: int32(limit + 1),
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    chirp, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, fmt.Sprintf("Failed to fetch chirp with ID: %v", chirpID))
+        return
+    }
+
+    ancestors, err := cfg.db.ListAncestors(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch thread")
+        return
+    }
+
+    replies, err := cfg.db.ListReplies(context.Background(), params)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch thread")
+        return
+    }
+
+    thread := ChirpThread{
+        Ancestors: []Chirp{},
+        Chirp: &ChirpThreadNode{Chirp: chirpFromDB(chirp), Replies: []*ChirpThreadNode{}},
+    }
+    for _, ancestor := range ancestors {
+        thread.Ancestors = append(thread.Ancestors, chirpFromDB(ancestor))
+    }
+
+    if len(replies) > limit {
+        replies = replies[:limit]
+        last := replies[len(replies) - 1]
+        thread.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, thread.NextCursor))
+    }
+
+    nodes := map[uuid.UUID]*ChirpThreadNode{}
+    replyIDs := []uuid.UUID{}
+    for _, reply := range replies {
+        node := &ChirpThreadNode{Chirp: chirpFromDB(reply), Replies: []*ChirpThreadNode{}}
+        thread.Chirp.Replies = append(thread.Chirp.Replies, node)
+        nodes[reply.ID] = node
+        replyIDs = append(replyIDs, reply.ID)
+    }
+
+    if depth > 1 && len(replyIDs) > 0 {
+        descendants, err := cfg.db.ListDescendants(context.Background(), database.ListDescendantsParams{
+            ParentIds: replyIDs,
+            MaxDepth: int32(depth - 1),
+            Limit: maxThreadReplies,
+        })
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to fetch thread")
+            return
+        }
+
+        // Replies are always newer than their parent, so walking in creation
+        // order sees every parent before its children.
+        for _, descendant := range descendants {
+            parent, ok := nodes[descendant.ParentID.UUID]
+            if !ok {
+                continue
+            }
+            node := &ChirpThreadNode{Chirp: chirpFromDB(descendant), Replies: []*ChirpThreadNode{}}
+            parent.Replies = append(parent.Replies, node)
+            nodes[descendant.ID] = node
+        }
+    }
+
+    err = cfg.decorateChirps(viewerID, thread.Ancestors)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch thread")
+        return
+    }
+
+    treeNodes := []*ChirpThreadNode{thread.Chirp}
+    for _, node := range nodes {
+        treeNodes = append(treeNodes, node)
+    }
+    treeChirps := make([]Chirp, 0, len(treeNodes))
+    for _, node := range treeNodes {
+        treeChirps = append(treeChirps, node.Chirp)
+    }
+    err = cfg.decorateChirps(viewerID, treeChirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch thread")
+        return
+    }
+    for idx, node := range treeNodes {
+        node.Chirp = treeChirps[idx]
+    }
+
+    respondWithJSON(w, http.StatusOK, thread)
+    return
+}
+
+// timelineBackfillLimit is how many recent chirps of a newly followed
+// account are copied into the follower's timeline.
+const timelineBackfillLimit = 100
+
+func (cfg *apiConfig) followUserHandler(w http.ResponseWriter, r *http.Request) {
+    followeeID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse user id")
+        return
+    }
+
+    userID, ok := cfg.authenticate(w, r, auth.ScopeUsersWrite)
+    if !ok {
+        return
+    }
+
+    if userID == followeeID {
+        respondWithError(w, http.StatusBadRequest, "Users cannot follow themselves")
+        return
+    }
+
+    followee, err := cfg.db.GetUserByID(context.Background(), followeeID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    followed, err := cfg.db.FollowUser(context.Background(), database.FollowUserParams{
+        FollowerID: userID,
+        FolloweeID: followee.ID,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to follow user")
+        return
+    }
+
+    if followed > 0 {
+        cfg.updateFanout(userID, followee)
+    }
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+// updateFanout runs after a new follow. Accounts that stay below the fan-out
+// threshold keep having their chirps pushed into timelines, so the follower
+// gets their recent chirps backfilled. Accounts that reach the threshold are
+// switched to fan-out-on-read for good. The follow itself has already
+// succeeded, so failures here are only logged.
+func (cfg *apiConfig) updateFanout(followerID uuid.UUID, followee database.User) {
+    if followee.FanoutOnRead {
+        return
+    }
+
+    followers, err := cfg.db.CountFollowers(context.Background(), followee.ID)
+    if err != nil {
+        log.Printf("Failed to count followers of %v: %v", followee.ID, err)
+        return
+    }
+
+    if followers >= cfg.fanoutReadThreshold {
+        err = cfg.db.SetFanoutOnRead(context.Background(), followee.ID)
+        if err != nil {
+            log.Printf("Failed to switch %v to fan-out-on-read: %v", followee.ID, err)
+        }
+        return
+    }
+
+    err = cfg.db.BackfillTimeline(context.Background(), database.BackfillTimelineParams{
+        UserID: followerID,
+        AuthorID: followee.ID,
+        Limit: timelineBackfillLimit,
+    })
+    if err != nil {
+        log.Printf("Failed to backfill timeline of %v: %v", followerID, err)
+    }
+}
+
+func (cfg *apiConfig) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+    followeeID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse user id")
+        return
+    }
+
+    userID, ok := cfg.authenticate(w, r, auth.ScopeUsersWrite)
+    if !ok {
+        return
+    }
+
+    _, err = cfg.db.UnfollowUser(context.Background(), database.UnfollowUserParams{
+        FollowerID: userID,
+        FolloweeID: followeeID,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to unfollow user")
+        return
+    }
+
+    err = cfg.db.DeleteTimelineEntriesFromAuthor(context.Background(), database.DeleteTimelineEntriesFromAuthorParams{
+        UserID: userID,
+        AuthorID: followeeID,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to update timeline")
+        return
+    }
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+func (cfg *apiConfig) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+    cfg.listFollows(w, r, false)
+}
+
+func (cfg *apiConfig) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+    cfg.listFollows(w, r, true)
+}
+
+// listFollows pages through either side of a user's follow graph, newest
+// follow first.
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, following bool) {
+    userID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse user id")
+        return
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListFollowersParams{
+        UserID: userID,
+        Limit: int32(limit + 1),
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    _, err = cfg.db.GetUserByID(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    var follows []database.ListFollowersRow
+    if following {
+        var rows []database.ListFollowingRow
+        rows, err = cfg.db.ListFollowing(context.Background(), database.ListFollowingParams(params))
+        for _, row := range rows {
+            follows = append(follows, database.ListFollowersRow(row))
+        }
+    } else {
+        follows, err = cfg.db.ListFollowers(context.Background(), params)
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch follows")
+        return
+    }
+
+    page := FollowPage{
+        Users: []Follow{},
+    }
+    if len(follows) > limit {
+        follows = follows[:limit]
+        last := follows[len(follows) - 1]
+        page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.UserID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    for _, follow := range follows {
+        page.Users = append(page.Users, Follow{
+            UserID: follow.UserID,
+            Handle: follow.Handle,
+            FollowedAt: follow.CreatedAt,
+        })
+    }
+
+    respondWithJSON(w, http.StatusOK, page)
+    return
+}
+
+func (cfg *apiConfig) getTimelineHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListTimelineParams{
+        UserID: userID,
+        Limit: int32(limit + 1),
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    chirps, err := cfg.db.ListTimeline(context.Background(), params)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch timeline")
+        return
+    }
+
+    page := ChirpPage{
+        Chirps: []Chirp{},
+    }
+    if len(chirps) > limit {
+        chirps = chirps[:limit]
+        last := chirps[len(chirps) - 1]
+        page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    for _, chirp := range chirps {
+        page.Chirps = append(page.Chirps, chirpFromDB(chirp))
+    }
+
+    err = cfg.decorateChirps(uuid.NullUUID{UUID: userID, Valid: true}, page.Chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    respondWithJSON(w, http.StatusOK, page)
+    return
+}
+
+func (cfg *apiConfig) getHashtagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListChirpsByHashtagParams{
+        Tag: entities.NormalizeHashtag(r.PathValue("tag")),
+        Limit: int32(limit + 1),
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    chirps, err := cfg.db.ListChirpsByHashtag(context.Background(), params)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    page := ChirpPage{
+        Chirps: []Chirp{},
+    }
+    if len(chirps) > limit {
+        chirps = chirps[:limit]
+        last := chirps[len(chirps) - 1]
+        page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    for _, chirp := range chirps {
+        page.Chirps = append(page.Chirps, chirpFromDB(chirp))
+    }
+
+    err = cfg.decorateChirps(viewerID, page.Chirps)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        return
+    }
+
+    respondWithJSON(w, http.StatusOK, page)
+    return
+}
+
+// searchHandler answers GET /api/search?q=, ranking chirps by default or
+// users with type=users. Results are ordered by rank, so pages use a
+// RankedCursor rather than the plain created_at one.
+func (cfg *apiConfig) searchHandler(w http.ResponseWriter, r *http.Request) {
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    query, err := search.Parse(r.URL.Query().Get("q"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    var cursor pagination.RankedCursor
+    cursorQuery := r.URL.Query().Get("cursor")
+    if cursorQuery != "" {
+        cursor, err = pagination.DecodeRankedCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+    }
+    cursorRank := sql.NullFloat64{Float64: cursor.Rank, Valid: cursorQuery != ""}
+    cursorCreatedAt := sql.NullTime{Time: cursor.CreatedAt, Valid: cursorQuery != ""}
+    cursorID := uuid.NullUUID{UUID: cursor.ID, Valid: cursorQuery != ""}
+
+    switch r.URL.Query().Get("type") {
+    case "", "chirps":
+        if query.Text == "" && query.From == "" {
+            respondWithError(w, http.StatusBadRequest, "Search query is required")
+            return
+        }
+
+        params := database.SearchChirpsParams{
+            Query: query.Text,
+            CursorRank: cursorRank,
+            CursorCreatedAt: cursorCreatedAt,
+            CursorID: cursorID,
+            Limit: int32(limit + 1),
+        }
+        if !query.Since.IsZero() {
+            params.Since = sql.NullTime{Time: query.Since, Valid: true}
+        }
+        if !query.Until.IsZero() {
+            params.Until = sql.NullTime{Time: query.Until, Valid: true}
+        }
+
+        page := ChirpPage{
+            Chirps: []Chirp{},
+        }
+        if query.From != "" {
+            var author database.User
+            author, err = cfg.db.GetUserByHandle(context.Background(), query.From)
+            if errors.Is(err, sql.ErrNoRows) {
+                respondWithJSON(w, http.StatusOK, page)
+                return
+            }
+            if err != nil {
+                respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+                return
+            }
+            params.AuthorID = uuid.NullUUID{UUID: author.ID, Valid: true}
+        }
+
+        var results []database.SearchChirpsRow
+        results, err = cfg.db.SearchChirps(context.Background(), params)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+            return
+        }
+
+        if len(results) > limit {
+            results = results[:limit]
+            last := results[len(results) - 1]
+            page.NextCursor = pagination.RankedCursor{Rank: last.Rank, CreatedAt: last.Chirp.CreatedAt, ID: last.Chirp.ID}.Encode()
+            w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+        }
+
+        for _, result := range results {
+            page.Chirps = append(page.Chirps, chirpFromDB(result.Chirp))
+        }
+
+        err = cfg.decorateChirps(viewerID, page.Chirps)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+            return
+        }
+
+        respondWithJSON(w, http.StatusOK, page)
+        return
+    case "users":
+        if query.Text == "" {
+            respondWithError(w, http.StatusBadRequest, "Search query is required")
+            return
+        }
+        if query.From != "" || !query.Since.IsZero() || !query.Until.IsZero() {
+            respondWithError(w, http.StatusBadRequest, "Operators only apply to chirp search")
+            return
+        }
+
+        var results []database.SearchUsersRow
+        results, err = cfg.db.SearchUsers(context.Background(), database.SearchUsersParams{
+            Query: query.Text,
+            CursorRank: cursorRank,
+            CursorCreatedAt: cursorCreatedAt,
+            CursorID: cursorID,
+            Limit: int32(limit + 1),
+        })
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to search users")
+            return
+        }
+
+        page := UserPage{
+            Users: []Author{},
+        }
+        if len(results) > limit {
+            results = results[:limit]
+            last := results[len(results) - 1]
+            page.NextCursor = pagination.RankedCursor{Rank: last.Rank, CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+            w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+        }
+
+        for _, result := range results {
+            page.Users = append(page.Users, Author{
+                ID: result.ID,
+                Handle: result.Handle,
+                DisplayName: result.DisplayName,
+                AvatarURL: result.AvatarUrl,
+            })
+        }
+
+        respondWithJSON(w, http.StatusOK, page)
+        return
+    default:
+        respondWithError(w, http.StatusBadRequest, "Type must be chirps or users")
+        return
+    }
+}
+
+// getTrendingHashtagsHandler serves the table kept by the trending job, so
+// it never scores tags itself.
+func (cfg *apiConfig) getTrendingHashtagsHandler(w http.ResponseWriter, r *http.Request) {
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    hashtags, err := cfg.db.ListTrendingHashtags(context.Background(), int32(limit))
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch trending hashtags")
+        return
+    }
+
+    trendingSlice := []TrendingHashtag{}
+    for _, hashtag := range hashtags {
+        trendingSlice = append(trendingSlice, TrendingHashtag{
+            Tag: hashtag.Tag,
+            Score: hashtag.Score,
+            Uses: hashtag.Uses,
+            ComputedAt: hashtag.ComputedAt,
+        })
+    }
+
+    respondWithJSON(w, http.StatusOK, trendingSlice)
+    return
+}
+
+const streamHeartbeatInterval = 15 * time.Second
+
+// streamHandler pushes chirp.created and chirp.deleted events as
+// Server-Sent Events. author_id narrows the stream to one author and
+// following=true to the viewer and the accounts they follow at connect
+// time. A Last-Event-ID header resumes from the hub's replay buffer; when
+// that cannot cover the gap, or the ID came from another instance's hub, a
+// reset event tells the client to refetch.
+func (cfg *apiConfig) streamHandler(w http.ResponseWriter, r *http.Request) {
+    viewerID, ok := cfg.authenticateOptional(w, r, auth.ScopeChirpsRead)
+    if !ok {
+        return
+    }
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        respondWithError(w, http.StatusInternalServerError, "Streaming is not supported")
+        return
+    }
+
+    authorQuery := r.URL.Query().Get("author_id")
+    following := r.URL.Query().Get("following") == "true"
+    if authorQuery != "" && following {
+        respondWithError(w, http.StatusBadRequest, "Use either author_id or following, not both")
+        return
+    }
+
+    // A nil set lets every author through.
+    var authors map[uuid.UUID]bool
+    if authorQuery != "" {
+        authorID, err := uuid.Parse(authorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, "Failed to parse author id")
+            return
+        }
+        authors = map[uuid.UUID]bool{authorID: true}
+    }
+    if following {
+        if !viewerID.Valid {
+            respondWithError(w, http.StatusUnauthorized, "Sign in to stream followed users")
+            return
+        }
+        followeeIDs, err := cfg.db.ListFolloweeIDs(context.Background(), viewerID.UUID)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to fetch followed users")
+            return
+        }
+        authors = map[uuid.UUID]bool{viewerID.UUID: true}
+        for _, followeeID := range followeeIDs {
+            authors[followeeID] = true
+        }
+    }
+
+    var sub *stream.Subscription
+    var missed []stream.Event
+    complete := true
+    if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+        sub, missed, complete = cfg.hub.Resume(lastEventID)
+    } else {
+        sub = cfg.hub.Subscribe()
+    }
+    defer sub.Close()
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("X-Accel-Buffering", "no")
+    w.WriteHeader(http.StatusOK)
+
+    if !complete {
+        fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+    }
+    for _, event := range missed {
+        if authors == nil || authors[event.AuthorID] {
+            stream.WriteEvent(w, event)
+        }
+    }
+    flusher.Flush()
+
+    heartbeat := time.NewTicker(streamHeartbeatInterval)
+    defer heartbeat.Stop()
+
+    for {
+        var err error
+        select {
+        case <-r.Context().Done():
+            return
+        case event, ok := <-sub.C:
+            // The hub closes the channel when we fall behind; the client
+            // reconnects with Last-Event-ID and catches up.
+            if !ok {
+                return
+            }
+            if authors != nil && !authors[event.AuthorID] {
+                continue
+            }
+            err = stream.WriteEvent(w, event)
+        case <-heartbeat.C:
+            _, err = fmt.Fprint(w, ": heartbeat\n\n")
+        }
+        if err != nil {
+            return
+        }
+        flusher.Flush()
+    }
+}
+
+func (cfg *apiConfig) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    params := database.ListNotificationsParams{
+        UserID: userID,
+        Limit: int32(limit + 1),
+    }
+
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
+
+    notifications, err := cfg.db.ListNotifications(context.Background(), params)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch notifications")
+        return
+    }
+
+    page := NotificationPage{
+        Notifications: []Notification{},
+    }
+    if len(notifications) > limit {
+        notifications = notifications[:limit]
+        last := notifications[len(notifications) - 1]
+        page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    for _, notification := range notifications {
+        converted := Notification{
+            ID: notification.ID,
+            CreatedAt: notification.CreatedAt,
+            Kind: notification.Kind,
+            ActorID: notification.ActorID,
+            Read: notification.ReadAt.Valid,
+        }
+        if notification.ChirpID.Valid {
+            converted.ChirpID = &notification.ChirpID.UUID
+        }
+        page.Notifications = append(page.Notifications, converted)
+    }
+
+    respondWithJSON(w, http.StatusOK, page)
+    return
+}
+
+func (cfg *apiConfig) readNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    _, err := cfg.db.MarkNotificationsRead(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to mark notifications as read")
+        return
+    }
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+func (cfg *apiConfig) loginUserHandler(w http.ResponseWriter, r *http.Request) {
+    type loginData struct {
+        Email string `json:"email"`
+        Password string `json:"password"`
+        ExpiresInSeconds time.Duration `json:"expires_in_seconds"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := loginData{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to process input")
+        return
+    }
+
+    accountSubject := strings.ToLower(strings.TrimSpace(reqData.Email))
+    ipSubject := clientIP(r)
+
+    if !cfg.checkLoginThrottle(w, accountSubject, ipSubject) {
+        return
+    }
+
+    user, err := cfg.db.GetUserByEmail(context.Background(), reqData.Email)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+        return
+    }
+
+    err = auth.CheckPasswordHash(user.HashedPassword, reqData.Password)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+        return
+    }
+    cfg.forgiveLoginAttempt(accountSubject, ipSubject)
+
+    if auth.PasswordNeedsRehash(user.HashedPassword) {
+        rehashed, err := auth.HashPassword(reqData.Password)
+        if err == nil {
+            err = cfg.db.UpdateUserPassword(context.Background(), database.UpdateUserPasswordParams{
+                ID: user.ID,
+                HashedPassword: rehashed,
+            })
+        }
+        if err != nil {
+            log.Printf("Failed to upgrade password hash for user %v: %v", user.ID, err)
+        }
+    }
+
+    totp, err := cfg.db.GetTOTPCredentialByUser(context.Background(), user.ID)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        respondWithError(w, http.StatusInternalServerError, "Failed to check two-factor status")
+        return
+    }
+    if err == nil && totp.ConfirmedAt.Valid {
+        challengeToken, err := auth.MakeTwoFactorChallengeToken(user.ID, cfg.jwtKeys, 5 * time.Minute)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to create challenge token")
+            return
+        }
+
+        respondWithJSON(w, http.StatusOK, TwoFactorChallenge{
+            TwoFactorRequired: true,
+            ChallengeToken: challengeToken,
+        })
+        return
+    }
+
+    var expiresIn time.Duration
+    if reqData.ExpiresInSeconds != 0 {
+        expiresIn = reqData.ExpiresInSeconds * time.Second
+    } else {
+        expiresIn = maxAccessTokenLifetime
+    }
+
+    cfg.completeLogin(w, r, user, expiresIn)
+    return
+}
+
+// maxAccessTokenLifetime caps the expires_in_seconds a client can ask for at
+// login. Routes outside middlewareRequireRole trust the token until it
+// expires, so this bounds how long a revoked grant can outlive its change.
+const maxAccessTokenLifetime = 1 * time.Hour
+
+// completeLogin resets the failed-login counter and hands out the access and
+// refresh tokens once every login factor has been checked.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, expiresIn time.Duration) {
+    if expiresIn <= 0 || expiresIn > maxAccessTokenLifetime {
+        expiresIn = maxAccessTokenLifetime
+    }
+
+    accountSubject := strings.ToLower(strings.TrimSpace(user.Email))
+    err := cfg.db.ClearLoginThrottle(context.Background(), database.ClearLoginThrottleParams{
+        Scope: loginScopeAccount,
+        Subject: accountSubject,
+    })
+    if err != nil {
+        log.Printf("Failed to clear login throttle for %s: %v", accountSubject, err)
+    }
+
+    jwtToken, err := auth.MakeJWT(user.ID, auth.Role(user.Role), cfg.jwtKeys, expiresIn)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create auth token")
+        return
+    }
+
+    refreshToken, err := cfg.issueRefreshToken(database.CreateRefreshTokenParams{
+        UserID: user.ID,
+        FamilyID: uuid.New(),
+        UserAgent: r.UserAgent(),
+        IpAddress: clientIP(r),
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create refresh token")
+        return
+    }
+
+    loggedUser := User{
+        ID: user.ID,
+        CreatedAt: user.CreatedAt,
+        UpdatedAt: user.UpdatedAt,
+        Email: user.Email,
+        IsChirpyRed: user.IsChirpyRed,
+        EmailVerified: user.EmailVerifiedAt.Valid,
+        Role: user.Role,
+        Handle: user.Handle,
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarURL: user.AvatarUrl,
+        Token: jwtToken,
+        RefreshToken: refreshToken.Token,
+    }
+
+    respondWithJSON(w, http.StatusOK, loggedUser)
+}
+
+func (cfg *apiConfig) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+    type reqStruct struct {
+        ChallengeToken string `json:"challenge_token"`
+        Code string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    userID, err := auth.ValidateTwoFactorChallengeToken(reqData.ChallengeToken, cfg.jwtKeys)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge token")
+        return
+    }
+
+    user, err := cfg.db.GetUserByID(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "User not found")
+        return
+    }
+
+    accountSubject := strings.ToLower(strings.TrimSpace(user.Email))
+    ipSubject := clientIP(r)
+
+    if !cfg.checkLoginThrottle(w, accountSubject, ipSubject) {
+        return
+    }
+
+    var used int64
+    if reqData.RecoveryCode != "" {
+        used, err = cfg.db.UseRecoveryCode(context.Background(), database.UseRecoveryCodeParams{
+            UserID: user.ID,
+            CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(reqData.RecoveryCode)),
+        })
+    } else {
+        var totp database.TotpCredential
+        totp, err = cfg.db.GetTOTPCredentialByUser(context.Background(), user.ID)
+        if err != nil || !totp.ConfirmedAt.Valid {
+            respondWithError(w, http.StatusUnauthorized, "Two-factor authentication is not enabled")
+            return
+        }
+
+        step, ok := auth.ValidateTOTP(totp.Secret, reqData.Code, time.Now())
+        if ok {
+            // Refuses a code, or an older one, that was already used.
+            used, err = cfg.db.UseTOTPStep(context.Background(), database.UseTOTPStepParams{
+                UserID: user.ID,
+                LastUsedStep: step,
+            })
+        }
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to check two-factor code")
+        return
+    }
+    if used == 0 {
+        respondWithError(w, http.StatusUnauthorized, "Incorrect two-factor code")
+        return
+    }
+    cfg.forgiveLoginAttempt(accountSubject, ipSubject)
+
+    cfg.completeLogin(w, r, user, 3600 * time.Second)
+    return
+}
+
+func (cfg *apiConfig) setupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    user, err := cfg.db.GetUserByID(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    secret, err := auth.GenerateTOTPSecret()
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create secret")
+        return
+    }
+
+    _, err = cfg.db.UpsertTOTPCredential(context.Background(), database.UpsertTOTPCredentialParams{
+        UserID: user.ID,
+        Secret: secret,
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to store secret")
+        return
+    }
+
+    setup := struct {
+        Secret string `json:"secret"`
+        OtpauthURI string `json:"otpauth_uri"`
+    }{
+        Secret: secret,
+        OtpauthURI: auth.TOTPURI(secret, "Chirpy", user.Email),
+    }
+
+    respondWithJSON(w, http.StatusOK, setup)
+    return
+}
+
+func (cfg *apiConfig) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    type reqStruct struct {
+        Code string `json:"code"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    totp, err := cfg.db.GetTOTPCredentialByUser(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "Two-factor setup has not been started")
+        return
+    }
+    if totp.ConfirmedAt.Valid {
+        respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+        return
+    }
+
+    step, ok := auth.ValidateTOTP(totp.Secret, reqData.Code, time.Now())
+    if !ok {
+        respondWithError(w, http.StatusUnauthorized, "Incorrect two-factor code")
+        return
+    }
+
+    confirmed, err := cfg.db.ConfirmTOTPCredential(context.Background(), database.ConfirmTOTPCredentialParams{
+        UserID: userID,
+        LastUsedStep: step,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+        return
+    }
+    if confirmed == 0 {
+        respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+        return
+    }
+
+    codes, err := auth.GenerateRecoveryCodes(10)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create recovery codes")
+        return
+    }
+
+    err = cfg.db.DeleteRecoveryCodesByUser(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to store recovery codes")
+        return
+    }
+    for _, code := range codes {
+        err = cfg.db.CreateRecoveryCode(context.Background(), database.CreateRecoveryCodeParams{
+            UserID: userID,
+            CodeHash: auth.HashToken(code),
+        })
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to store recovery codes")
+            return
+        }
+    }
+
+    confirmedResp := struct {
+        RecoveryCodes []string `json:"recovery_codes"`
+    }{
+        RecoveryCodes: codes,
+    }
+
+    respondWithJSON(w, http.StatusOK, confirmedResp)
+    return
+}
+
+const (
+    loginScopeAccount = "account"
+    loginScopeIP = "ip"
+    resetScopeAccount = "reset_account"
+    resetScopeIP = "reset_ip"
+)
+
+type loginThrottleKey struct {
+    scope string
+    subject string
+    policy auth.LockoutPolicy
+}
+
+func (cfg *apiConfig) loginThrottleKeys(accountSubject, ipSubject string) []loginThrottleKey {
+    return []loginThrottleKey{
+        {loginScopeAccount, accountSubject, cfg.accountLockout},
+        {loginScopeIP, ipSubject, cfg.ipLockout},
+    }
+}
+
+// resetThrottleKeys limits password reset mail per address and per client IP.
+// Every request counts, since none of them can prove who sent it.
+func (cfg *apiConfig) resetThrottleKeys(accountSubject, ipSubject string) []loginThrottleKey {
+    return []loginThrottleKey{
+        {resetScopeAccount, accountSubject, cfg.resetAccountLimit},
+        {resetScopeIP, ipSubject, cfg.resetIPLimit},
+    }
+}
+
+// checkLoginThrottle counts a login attempt against both the account and the
+// client IP, then responds with 429 and returns false if either is still
+// backing off. The attempt is recorded before any credential is checked and
+// counts as a failure until forgiveLoginAttempt takes it back, so parallel
+// guesses each see the ones that came before them.
+func (cfg *apiConfig) checkLoginThrottle(w http.ResponseWriter, accountSubject, ipSubject string) bool {
+    checks := cfg.loginThrottleKeys(accountSubject, ipSubject)
+    return cfg.checkThrottle(w, checks, "Too many failed login attempts, try again later")
+}
+
+// checkThrottle records an attempt under every key and responds with 429 and
+// the given message, returning false, while any of them is backing off.
+func (cfg *apiConfig) checkThrottle(w http.ResponseWriter, checks []loginThrottleKey, message string) bool {
+    var wait time.Duration
+    for _, check := range checks {
+        throttle, err := cfg.db.RecordLoginAttempt(context.Background(), database.RecordLoginAttemptParams{
+            Scope: check.scope,
+            Subject: check.subject,
+            ResetAfterSeconds: check.policy.ResetAfter.Seconds(),
+        })
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to check login attempts")
+            return false
+        }
+        if !throttle.PreviousFailureAt.Valid {
+            continue
+        }
+
+        // Both timestamps come from the database clock, and this attempt
+        // must wait out the failures recorded before it.
+        retryAt := check.policy.RetryAt(int(throttle.Failures) - 1, throttle.PreviousFailureAt.Time)
+        if retryAt.Sub(throttle.LastFailureAt) > wait {
+            wait = retryAt.Sub(throttle.LastFailureAt)
+        }
+    }
+
+    if wait <= 0 {
+        return true
+    }
+
+    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+    respondWithError(w, http.StatusTooManyRequests, message)
+    return false
+}
+
+// forgiveLoginAttempt takes back the attempt checkLoginThrottle counted once a
+// login factor turns out to be correct.
+func (cfg *apiConfig) forgiveLoginAttempt(accountSubject, ipSubject string) {
+    attempts := cfg.loginThrottleKeys(accountSubject, ipSubject)
+
+    for _, attempt := range attempts {
+        err := cfg.db.ForgiveLoginAttempt(context.Background(), database.ForgiveLoginAttemptParams{
+            Scope: attempt.scope,
+            Subject: attempt.subject,
+        })
+        if err != nil {
+            log.Printf("Failed to forgive login attempt for %s %s: %v", attempt.scope, attempt.subject, err)
+        }
+    }
+}
+
+func (cfg *apiConfig) unlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+    type reqStruct struct {
+        Email string `json:"email"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    err = cfg.db.ClearLoginThrottle(context.Background(), database.ClearLoginThrottleParams{
+        Scope: loginScopeAccount,
+        Subject: strings.ToLower(strings.TrimSpace(reqData.Email)),
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to unlock account")
+        return
+    }
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+// issueRefreshToken fills in a fresh random token and expiry, then stores it.
+func (cfg *apiConfig) issueRefreshToken(params database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+    randToken, err := auth.MakeRefreshToken()
+    if err != nil {
+        return database.RefreshToken{}, err
+    }
+
+    params.Token = randToken
+    params.ExpiresAt = time.Now().AddDate(0, 0, 60)
+    params.RevokedAt = sql.NullTime{}
+
+    return cfg.db.CreateRefreshToken(context.Background(), params)
+}
+
+func (cfg *apiConfig) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+    token, err := auth.GetBearerToken(r.Header)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Auth header not found")
+        return
+    }
+
+    refreshToken, err := cfg.db.GetRefreshTokenByToken(context.Background(), token)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Refresh token does not exist")
+        return
+    }
+
+    // A revoked token coming back means it leaked, so the whole family goes.
+    if refreshToken.RevokedAt.Valid {
+        cfg.revokeTokenFamily(w, refreshToken)
+        return
+    }
+
+    if time.Now().After(refreshToken.ExpiresAt) {
+        respondWithError(w, http.StatusUnauthorized, "Refresh token is expired")
+        return
+    }
+
+    revoked, err := cfg.db.RevokeActiveRefreshToken(context.Background(), refreshToken.Token)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to rotate refresh token")
+        return
+    }
+    if revoked == 0 {
+        // Lost a race against another request presenting the same token.
+        cfg.revokeTokenFamily(w, refreshToken)
+        return
+    }
+
+    newRefreshToken, err := cfg.issueRefreshToken(database.CreateRefreshTokenParams{
+        UserID: refreshToken.UserID,
+        FamilyID: refreshToken.FamilyID,
+        ParentToken: sql.NullString{
+            String: refreshToken.Token,
+            Valid: true,
+        },
+        UserAgent: refreshToken.UserAgent,
+        IpAddress: refreshToken.IpAddress,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create refresh token")
+        return
+    }
+
+    // Roles are read fresh so a role change applies from the next refresh.
+    user, err := cfg.db.GetUserByID(context.Background(), refreshToken.UserID)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "User not found")
+        return
+    }
+
+    jwtToken, err := auth.MakeJWT(user.ID, auth.Role(user.Role), cfg.jwtKeys, 1 * time.Hour)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create new token")
+        return
+    }
+
+    newToken := struct {
+        Token string `json:"token"`
+        RefreshToken string `json:"refresh_token"`
+    }{
+        Token: jwtToken,
+        RefreshToken: newRefreshToken.Token,
+    }
+
+    respondWithJSON(w, http.StatusOK, newToken)
+    return
+}
+
+func (cfg *apiConfig) revokeTokenFamily(w http.ResponseWriter, refreshToken database.RefreshToken) {
+    err := cfg.db.RevokeRefreshTokenFamily(context.Background(), refreshToken.FamilyID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to revoke refresh tokens")
+        return
+    }
+    cfg.publishEvent(events.TokenRevoked, refreshToken.UserID, TokenRevoked{UserID: refreshToken.UserID, Kind: "session", ID: &refreshToken.FamilyID})
+
+    respondWithError(w, http.StatusUnauthorized, "Refresh token reuse detected, please log in again")
+}
+
+func (cfg *apiConfig) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+    token, err := auth.GetBearerToken(r.Header)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Auth header not found")
+        return
+    }
+
+    err = cfg.db.UpdateRevokeToken(context.Background(), token)
+    if err != nil {
+        respondWithError(w, http.StatusUnauthorized, "Token did not exists")
+        return
+    }
+
+    refreshToken, err := cfg.db.GetRefreshTokenByToken(context.Background(), token)
+    if err == nil {
+        cfg.publishEvent(events.TokenRevoked, refreshToken.UserID, TokenRevoked{UserID: refreshToken.UserID, Kind: "session", ID: &refreshToken.FamilyID})
+    }
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+func (cfg *apiConfig) getSessionsHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    sessions, err := cfg.db.ListActiveSessionsByUser(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+        return
+    }
+
+    sessionsSlice := []Session{}
+    for _, session := range sessions {
+        sessionsSlice = append(sessionsSlice, Session{
+            ID: session.FamilyID,
+            CreatedAt: session.CreatedAt,
+            ExpiresAt: session.ExpiresAt,
+            UserAgent: session.UserAgent,
+            IPAddress: session.IpAddress,
+        })
+    }
+
+    respondWithJSON(w, http.StatusOK, sessionsSlice)
+    return
+}
+
+func (cfg *apiConfig) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    sessionID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse session id")
+        return
+    }
+
+    revoked, err := cfg.db.RevokeSessionByUser(context.Background(), database.RevokeSessionByUserParams{
+        FamilyID: sessionID,
+        UserID: userID,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to revoke session")
+        return
+    }
+    if revoked == 0 {
+        respondWithError(w, http.StatusNotFound, "Session not found")
+        return
+    }
+    cfg.publishEvent(events.TokenRevoked, userID, TokenRevoked{UserID: userID, Kind: "session", ID: &sessionID})
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+func (cfg *apiConfig) revokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    err := cfg.db.RevokeAllRefreshTokensByUser(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+        return
+    }
+    cfg.publishEvent(events.TokenRevoked, userID, TokenRevoked{UserID: userID, Kind: "all_sessions"})
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+// clientIP returns the remote host of the request without its port.
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+
+    return host
+}
+
+func (cfg *apiConfig) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+    type reqStruct struct {
+        Email string `json:"email"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    resetChecks := cfg.resetThrottleKeys(strings.ToLower(strings.TrimSpace(reqData.Email)), clientIP(r))
+    if !cfg.checkThrottle(w, resetChecks, "Too many password reset requests, try again later") {
+        return
+    }
+
+    // Mail in the background and always answer 202 so the response gives
+    // away neither whether the account exists nor how long mailing took.
+    go func(email string) {
+        user, err := cfg.db.GetUserByEmail(context.Background(), email)
+        if err != nil {
+            return
+        }
+
+        err = cfg.sendPasswordResetEmail(user)
+        if err != nil {
+            log.Printf("Failed to send password reset email to user %v: %v", user.ID, err)
+        }
+    }(reqData.Email)
+
+    respondWithJSON(w, http.StatusAccepted, nil)
+    return
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(user database.User) error {
+    token, err := auth.MakeRefreshToken()
+    if err != nil {
+        return err
+    }
+
+    _, err = cfg.db.CreatePasswordReset(context.Background(), database.CreatePasswordResetParams{
+        TokenHash: auth.HashToken(token),
+        UserID: user.ID,
+        ExpiresAt: time.Now().Add(1 * time.Hour),
+    })
+    if err != nil {
+        return err
+    }
+
+    return cfg.mailer.Send(context.Background(), mail.Message{
+        To: user.Email,
+        Subject: "Reset your Chirpy password",
+        Body: fmt.Sprintf("Someone asked to reset your Chirpy password. If it was you, send this token with your new password to POST /api/password/reset within an hour:\n\n%s\n\nIf it was not you, you can ignore this email.\n", token),
+    })
+}
+
+func (cfg *apiConfig) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+    type reqStruct struct {
+        Token string `json:"token"`
+        Password string `json:"password"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    if reqData.Password == "" {
+        respondWithError(w, http.StatusBadRequest, "Password is required")
+        return
+    }
+
+    hashedPassword, err := auth.HashPassword(reqData.Password)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+        return
+    }
+
+    // The token is only spent if the password change and the session
+    // revocation land with it.
+    var userID uuid.UUID
+    err = cfg.inTx(func(q *database.Queries) error {
+        var err error
+        userID, err = q.ConsumePasswordReset(context.Background(), auth.HashToken(reqData.Token))
+        if err != nil {
+            return err
+        }
+
+        err = q.UpdateUserPassword(context.Background(), database.UpdateUserPasswordParams{
+            ID: userID,
+            HashedPassword: hashedPassword,
+        })
+        if err != nil {
+            return err
+        }
+
+        err = q.InvalidatePasswordResetsByUser(context.Background(), userID)
+        if err != nil {
+            return err
+        }
+
+        return q.RevokeAllRefreshTokensByUser(context.Background(), userID)
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        respondWithError(w, http.StatusBadRequest, "Reset token is invalid, used, or expired")
+        return
+    }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+        return
+    }
+    cfg.publishEvent(events.TokenRevoked, userID, TokenRevoked{UserID: userID, Kind: "all_sessions"})
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+func (cfg *apiConfig) createPersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    type reqStruct struct {
+        Name string `json:"name"`
+        Scopes []string `json:"scopes"`
+        ExpiresInDays int `json:"expires_in_days"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    if strings.TrimSpace(reqData.Name) == "" {
+        respondWithError(w, http.StatusBadRequest, "Token name is required")
+        return
+    }
+    if len(reqData.Scopes) == 0 {
+        respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+        return
+    }
+    for _, scope := range reqData.Scopes {
+        if !auth.ValidScope(scope) {
+            respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope: %s", scope))
+            return
+        }
+    }
+    if reqData.ExpiresInDays < 0 {
+        respondWithError(w, http.StatusBadRequest, "Expiry must not be negative")
+        return
+    }
+
+    expiresAt := sql.NullTime{}
+    if reqData.ExpiresInDays > 0 {
+        expiresAt = sql.NullTime{
+            Time: time.Now().AddDate(0, 0, reqData.ExpiresInDays),
+            Valid: true,
+        }
+    }
+
+    token, err := auth.MakePersonalAccessToken()
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create access token")
+        return
+    }
+
+    pat, err := cfg.db.CreatePersonalAccessToken(context.Background(), database.CreatePersonalAccessTokenParams{
+        UserID: userID,
+        Name: reqData.Name,
+        TokenHash: auth.HashToken(token),
+        Scopes: reqData.Scopes,
+        ExpiresAt: expiresAt,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create access token")
+        return
+    }
+
+    createdToken := personalAccessTokenFromDB(pat)
+    createdToken.Token = token
+
+    respondWithJSON(w, http.StatusCreated, createdToken)
+    return
+}
+
+func (cfg *apiConfig) getPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    pats, err := cfg.db.ListPersonalAccessTokensByUser(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch access tokens")
+        return
+    }
+
+    patsSlice := []PersonalAccessToken{}
+    for _, pat := range pats {
+        patsSlice = append(patsSlice, personalAccessTokenFromDB(pat))
+    }
+
+    respondWithJSON(w, http.StatusOK, patsSlice)
+    return
+}
+
+func (cfg *apiConfig) deletePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    tokenID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse token id")
+        return
+    }
+
+    revoked, err := cfg.db.RevokePersonalAccessToken(context.Background(), database.RevokePersonalAccessTokenParams{
+        ID: tokenID,
+        UserID: userID,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to revoke access token")
+        return
+    }
+    if revoked == 0 {
+        respondWithError(w, http.StatusNotFound, "Access token not found")
+        return
+    }
+    cfg.publishEvent(events.TokenRevoked, userID, TokenRevoked{UserID: userID, Kind: "personal_access_token", ID: &tokenID})
+
+    respondWithJSON(w, http.StatusNoContent, nil)
+    return
+}
+
+func personalAccessTokenFromDB(pat database.PersonalAccessToken) PersonalAccessToken {
+    token := PersonalAccessToken{
+        ID: pat.ID,
+        CreatedAt: pat.CreatedAt,
+        Name: pat.Name,
+        Scopes: pat.Scopes,
+    }
+    if pat.ExpiresAt.Valid {
+        token.ExpiresAt = &pat.ExpiresAt.Time
+    }
+    if pat.LastUsedAt.Valid {
+        token.LastUsedAt = &pat.LastUsedAt.Time
+    }
+
+    return token
+}
+
+func (cfg *apiConfig) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    type reqStruct struct {
+        URL string `json:"url"`
+        Events []string `json:"events"`
+        AllUsers bool `json:"all_users"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err := decoder.Decode(&reqData)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
+        return
+    }
+
+    err = cfg.validateWebhookURL(reqData.URL)
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if len(reqData.Events) == 0 {
+        respondWithError(w, http.StatusBadRequest, "At least one event is required")
+        return
+    }
+    subscribed := []string{}
+    for _, eventType := range reqData.Events {
+        if !webhooks.ValidEvent(eventType) {
+            respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown event: %s", eventType))
+            return
+        }
+        if !slices.Contains(subscribed, eventType) {
+            subscribed = append(subscribed, eventType)
+        }
+    }
+
+    // Hearing about every user's activity is an admin privilege. Enqueueing
+    // checks the owner's role again, so a demoted admin's all_users
+    // subscription only hears about their own activity from then on.
+    if reqData.AllUsers {
+        user, err := cfg.db.GetUserByID(context.Background(), userID)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
+            return
+        }
+        if !auth.Role(user.Role).AtLeast(auth.RoleAdmin) {
+            respondWithError(w, http.StatusForbidden, "Only admins can subscribe to all users")
+            return
+        }
+    }
+
+    secret, err := webhooks.MakeSecret()
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+        return
+    }
+
+    subscription, err := cfg.db.CreateWebhookSubscription(context.Background(), database.CreateWebhookSubscriptionParams{
+        UserID: userID,
+        Url: reqData.URL,
+        Secret: secret,
+        Events: subscribed,
+        AllUsers: reqData.AllUsers,
+    })
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+        return
+    }
+
+    createdSubscription := webhookSubscriptionFromDB(subscription)
+    createdSubscription.Secret = subscription.Secret
+
+    respondWithJSON(w, http.StatusCreated, createdSubscription)
+    return
+}
+
+// validateWebhookURL accepts absolute https URLs, and http ones in dev.
+// Where the URL resolves is checked again when each delivery is sent.
+func (cfg *apiConfig) validateWebhookURL(rawURL string) error {
+    u, err := url.Parse(rawURL)
+    if err != nil || u.Host == "" {
+        return errors.New("Webhook URL must be absolute")
+    }
+    if u.User != nil {
+        return errors.New("Webhook URL must not contain credentials")
+    }
+    if u.Scheme != "https" && !(u.Scheme == "http" && cfg.platform == "dev") {
+        return errors.New("Webhook URL must use https")
+    }
+
+    return nil
+}
+
+func (cfg *apiConfig) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
+
+    subscriptions, err := cfg.db.ListWebhookSubscriptionsByUser(context.Background(), userID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch webhooks")
+        return
+    }
+
+    subscriptionsSlice := []WebhookSubscription{}
+    for _, subscription := range subscriptions {
+        subscriptionsSlice = append(subscriptionsSlice, webhookSubscriptionFromDB(subscription))
+    }
+
+    respondWithJSON(w, http.StatusOK, subscriptionsSlice)
+    return
+}
 
-    cleanWord := func(word string) string {
-        return strings.TrimFunc(word, func(r rune) bool {
-            return !unicode.IsLetter(r)
-        })
+func (cfg *apiConfig) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
     }
 
-    words := strings.Split(reqData.Body, " ")
-    for idx, word := range words {
-        lower := cleanWord(strings.ToLower(word)) 
-        if profanities[lower] {
-            words[idx] = "****"
-        }
+    subscriptionID, err := uuid.Parse(r.PathValue("id"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, "Failed to parse webhook id")
+        return
     }
-    res := strings.Join(words, " ")
 
-    resp, err := cfg.db.CreateChirp(context.Background(), database.CreateChirpParams{
-        Body: res,
-        UserID: reqData.UserID,
+    deleted, err := cfg.db.DeleteWebhookSubscription(context.Background(), database.DeleteWebhookSubscriptionParams{
+        ID: subscriptionID,
+        UserID: userID,
     })
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to create chirp")
+        respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook")
         return
     }
-
-    createdChirp := Chirp{
-        ID: resp.ID,
-        CreatedAt: resp.CreatedAt,
-        UpdatedAt: resp.UpdatedAt,
-        Body: resp.Body,
-        UserID: resp.UserID,
+    if deleted == 0 {
+        respondWithError(w, http.StatusNotFound, "Webhook not found")
+        return
     }
 
-    respondWithJSON(w, http.StatusCreated, createdChirp)
+    respondWithJSON(w, http.StatusNoContent, nil)
     return
 }
 
-func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
-    authorID := r.URL.Query().Get("author_id")
-    sortQuery := r.URL.Query().Get("sort")
+// getWebhookDeliveriesHandler pages through a subscription's deliveries,
+// newest first, each with every attempt made to send it.
+func (cfg *apiConfig) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+    userID, ok := cfg.authenticate(w, r, "")
+    if !ok {
+        return
+    }
 
-    chirps, err := cfg.db.GetChirps(context.Background())
+    subscriptionID, err := uuid.Parse(r.PathValue("id"))
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+        respondWithError(w, http.StatusBadRequest, "Failed to parse webhook id")
         return
     }
 
-    var chirpsSlice []Chirp
-    for _, chirp := range chirps {
-        chirpsSlice = append(chirpsSlice, Chirp{
-            ID: chirp.ID,
-            CreatedAt: chirp.CreatedAt,
-            UpdatedAt: chirp.UpdatedAt,
-            Body: chirp.Body,
-            UserID: chirp.UserID,
-        })
+    limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+    if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+        return
     }
 
-    if sortQuery == "desc" {
-        sort.Slice(chirpsSlice, func(i, j int) bool {
-            return chirpsSlice[j].CreatedAt.Before(chirpsSlice[i].CreatedAt)
-        })
+    params := database.ListWebhookDeliveriesParams{
+        SubscriptionID: subscriptionID,
+        Limit: int32(limit + 1),
     }
 
-    if authorID != "" {
-        var chirpsByAuthor []Chirp
-        for _, chirp := range chirpsSlice {
-            if chirp.UserID.String() == authorID {
-                chirpsByAuthor = append(chirpsByAuthor, chirp)
-            }
+    if cursorQuery := r.URL.Query().Get("cursor"); cursorQuery != "" {
+        cursor, err := pagination.DecodeCursor(cursorQuery)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
         }
+        params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+        params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+    }
 
-        respondWithJSON(w, http.StatusOK, chirpsByAuthor)
+    // Someone else's webhook gets the same 404 as a missing one.
+    subscription, err := cfg.db.GetWebhookSubscription(context.Background(), subscriptionID)
+    if err != nil || subscription.UserID != userID {
+        respondWithError(w, http.StatusNotFound, "Webhook not found")
         return
     }
 
-    respondWithJSON(w, http.StatusOK, chirpsSlice)
-    return
-}
-
-func (cfg *apiConfig) getChirpByIDHandler(w http.ResponseWriter, r *http.Request) {
-    stringID := r.PathValue("chirpID")
-    chirpID, err := uuid.Parse(stringID)
+    deliveries, err := cfg.db.ListWebhookDeliveries(context.Background(), params)
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to parse string into id")
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch deliveries")
         return
     }
 
-    chirpData, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+    page := WebhookDeliveryPage{
+        Deliveries: []WebhookDelivery{},
+    }
+    if len(deliveries) > limit {
+        deliveries = deliveries[:limit]
+        last := deliveries[len(deliveries) - 1]
+        page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+        w.Header().Set("Link", pagination.NextLink(r.URL, page.NextCursor))
+    }
+
+    deliveryIDs := []uuid.UUID{}
+    for _, delivery := range deliveries {
+        deliveryIDs = append(deliveryIDs, delivery.ID)
+    }
+    attempts, err := cfg.db.ListWebhookAttemptsByDeliveryIDs(context.Background(), deliveryIDs)
     if err != nil {
-        respondWithError(w, http.StatusNotFound, fmt.Sprintf("Failed to fetch chirp with ID: %v", chirpID))
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch delivery attempts")
         return
     }
 
-    chirp := Chirp{
-        ID: chirpData.ID,
-        CreatedAt: chirpData.CreatedAt,
-        UpdatedAt: chirpData.UpdatedAt,
-        Body: chirpData.Body,
-        UserID: chirpData.UserID,
+    attemptsByDelivery := map[uuid.UUID][]WebhookAttempt{}
+    for _, attempt := range attempts {
+        webhookAttempt := WebhookAttempt{
+            AttemptedAt: attempt.AttemptedAt,
+            Error: attempt.Error,
+            DurationMs: attempt.DurationMs,
+        }
+        if attempt.StatusCode.Valid {
+            webhookAttempt.StatusCode = &attempt.StatusCode.Int32
+        }
+        attemptsByDelivery[attempt.DeliveryID] = append(attemptsByDelivery[attempt.DeliveryID], webhookAttempt)
+    }
+
+    for _, delivery := range deliveries {
+        webhookDelivery := WebhookDelivery{
+            ID: delivery.ID,
+            CreatedAt: delivery.CreatedAt,
+            EventType: delivery.EventType,
+            Status: delivery.Status,
+            Attempts: delivery.Attempts,
+            AttemptLog: []WebhookAttempt{},
+        }
+        if delivery.Status == webhooks.StatusPending {
+            webhookDelivery.NextAttemptAt = &delivery.NextAttemptAt
+        }
+        if delivery.DeliveredAt.Valid {
+            webhookDelivery.DeliveredAt = &delivery.DeliveredAt.Time
+        }
+        if logged, ok := attemptsByDelivery[delivery.ID]; ok {
+            webhookDelivery.AttemptLog = logged
+        }
+        page.Deliveries = append(page.Deliveries, webhookDelivery)
     }
 
-    respondWithJSON(w, http.StatusOK, chirp)
+    respondWithJSON(w, http.StatusOK, page)
     return
 }
 
-func (cfg *apiConfig) loginUserHandler(w http.ResponseWriter, r *http.Request) {
-    type loginData struct {
+func webhookSubscriptionFromDB(subscription database.WebhookSubscription) WebhookSubscription {
+    return WebhookSubscription{
+        ID: subscription.ID,
+        CreatedAt: subscription.CreatedAt,
+        URL: subscription.Url,
+        Events: subscription.Events,
+        AllUsers: subscription.AllUsers,
+    }
+}
+
+func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+    // Email and password are replaced together. The profile fields are
+    // optional and left alone when omitted.
+    type newData struct {
         Email string `json:"email"`
         Password string `json:"password"`
-        ExpiresInSeconds time.Duration `json:"expires_in_seconds"`
+        Handle *string `json:"handle"`
+        DisplayName *string `json:"display_name"`
+        Bio *string `json:"bio"`
+        AvatarURL *string `json:"avatar_url"`
     }
 
     decoder := json.NewDecoder(r.Body)
-    reqData := loginData{}
+    reqData := newData{}
     err := decoder.Decode(&reqData)
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to process input")
+        respondWithError(w, http.StatusInternalServerError, "Failed to decode input")
         return
     }
 
-    user, err := cfg.db.GetUserByEmail(context.Background(), reqData.Email)
-    if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+    // Changing the email or password is an account takeover in the wrong
+    // hands, so it needs a session. A personal access token with users:write
+    // can only edit the profile.
+    scope := auth.ScopeUsersWrite
+    if reqData.Email != "" || reqData.Password != "" {
+        scope = ""
+    }
+    userID, ok := cfg.authenticate(w, r, scope)
+    if !ok {
         return
     }
 
-    err = auth.CheckPasswordHash(user.HashedPassword, reqData.Password)
+    oldUserData, err := cfg.db.GetUserByID(context.Background(), userID)
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+        respondWithError(w, http.StatusNotFound, "User not found")
         return
     }
 
-    var expiresIn time.Duration
-    if reqData.ExpiresInSeconds != 0 {
-        expiresIn = reqData.ExpiresInSeconds * time.Second
-    } else {
-        expiresIn = 3600 * time.Second
+    // Everything is validated before anything is written, and the writes
+    // share a transaction, so a rejected request changes nothing.
+    updateProfile := reqData.Handle != nil || reqData.DisplayName != nil || reqData.Bio != nil || reqData.AvatarURL != nil
+    updateCredentials := reqData.Email != "" || reqData.Password != ""
+    if !updateProfile && !updateCredentials {
+        respondWithError(w, http.StatusBadRequest, "Nothing to update")
+        return
     }
-
-    jwtToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, expiresIn)
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to create auth token")
+    if updateCredentials && (reqData.Email == "" || reqData.Password == "") {
+        respondWithError(w, http.StatusBadRequest, "Email and password must be updated together")
         return
     }
+    if updateCredentials {
+        err = validateEmail(reqData.Email)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+    }
 
-    randToken, err := auth.MakeRefreshToken()
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to create refresh token")
-        return
+    profile := database.UpdateUserProfileParams{
+        ID: userID,
+        Handle: oldUserData.Handle,
+        DisplayName: oldUserData.DisplayName,
+        Bio: oldUserData.Bio,
+        AvatarUrl: oldUserData.AvatarUrl,
     }
+    if updateProfile {
+        if reqData.Handle != nil {
+            profile.Handle = *reqData.Handle
+        }
+        if reqData.DisplayName != nil {
+            profile.DisplayName = strings.TrimSpace(*reqData.DisplayName)
+        }
+        if reqData.Bio != nil {
+            profile.Bio = strings.TrimSpace(*reqData.Bio)
+        }
+        if reqData.AvatarURL != nil {
+            profile.AvatarUrl = strings.TrimSpace(*reqData.AvatarURL)
+        }
 
-    refreshToken, err := cfg.db.CreateRefreshToken(context.Background(), database.CreateRefreshTokenParams{
-        Token: randToken,
-        UserID: user.ID,
-        ExpiresAt: time.Now().AddDate(0, 0, 60),
-        RevokedAt: sql.NullTime{},
+        err = validateProfile(profile)
+        if err != nil {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        if cfg.handleTaken(profile.Handle, userID) {
+            respondWithError(w, http.StatusConflict, "Handle is already taken")
+            return
+        }
+    }
+
+    credentials := database.UpdateUserByIDParams{
+        ID: userID,
+        Email: reqData.Email,
+    }
+    if updateCredentials {
+        credentials.HashedPassword, err = auth.HashPassword(reqData.Password)
+        if err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+            return
+        }
+    }
+
+    newUserData := oldUserData
+    err = cfg.inTx(func(q *database.Queries) error {
+        var err error
+        if updateProfile {
+            newUserData, err = q.UpdateUserProfile(context.Background(), profile)
+            if err != nil {
+                return err
+            }
+        }
+        if updateCredentials {
+            newUserData, err = q.UpdateUserByID(context.Background(), credentials)
+            if err != nil {
+                return err
+            }
+        }
+        return nil
     })
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to create refresh token")
+        respondWithError(w, http.StatusInternalServerError, "Failed to update user")
         return
     }
 
-    loggedUser := User{
-        ID: user.ID,
-        CreatedAt: user.CreatedAt,
-        UpdatedAt: user.UpdatedAt,
-        Email: user.Email,
-        IsChirpyRed: user.IsChirpyRed,
-        Token: jwtToken,
-        RefreshToken: refreshToken.Token,
+    if newUserData.Email != oldUserData.Email {
+        err = cfg.sendVerificationEmail(newUserData)
+        if err != nil {
+            log.Printf("Failed to send verification email to user %v: %v", newUserData.ID, err)
+        }
     }
 
-    respondWithJSON(w, http.StatusOK, loggedUser)
+    newUser := User{
+        ID: newUserData.ID,
+        CreatedAt: newUserData.CreatedAt,
+        UpdatedAt: newUserData.UpdatedAt,
+        Email: newUserData.Email,
+        IsChirpyRed: newUserData.IsChirpyRed,
+        EmailVerified: newUserData.EmailVerifiedAt.Valid,
+        Role: newUserData.Role,
+        Handle: newUserData.Handle,
+        DisplayName: newUserData.DisplayName,
+        Bio: newUserData.Bio,
+        AvatarURL: newUserData.AvatarUrl,
+    }
+
+    respondWithJSON(w, http.StatusOK, newUser)
     return
 }
 
-func (cfg *apiConfig) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-    token, err := auth.GetBearerToken(r.Header)
+func (cfg *apiConfig) deleteChirpByIDHandler (w http.ResponseWriter, r *http.Request) {
+    stringID := r.PathValue("chirpID")
+    chirpID, err := uuid.Parse(stringID)
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Auth header not found")
-        return
+        respondWithError(w, http.StatusInternalServerError, "Failed to parse chirp id")
     }
-
-    refreshToken, err := cfg.db.GetRefreshTokenByToken(context.Background(), token)
-    if err != nil || refreshToken.RevokedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
-        respondWithError(w, http.StatusUnauthorized, "Refresh token does not exist, is revoked, or is expired")
+    chirp, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+    if err != nil {
+        respondWithError(w, http.StatusNotFound, "Failed to fetch chirp")
         return
     }
 
-    jwtToken, err := auth.MakeJWT(refreshToken.UserID, cfg.jwtSecret, 1 * time.Hour)
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to create new token")
+    userID, ok := cfg.authenticate(w, r, auth.ScopeChirpsWrite)
+    if !ok {
         return
     }
 
-    newToken := struct {
-        Token string `json:"token"`
-    }{
-        Token: jwtToken,
+    if userID != chirp.UserID {
+        respondWithError(w, http.StatusForbidden, "User unauthorized")
+        return
     }
 
-    respondWithJSON(w, http.StatusOK, newToken)
-    return
-}
-
-func (cfg *apiConfig) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
-    token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Auth header not found")
+    if chirp.DeletedAt.Valid {
+        respondWithError(w, http.StatusNotFound, "Chirp not found")
         return
     }
 
-    err = cfg.db.UpdateRevokeToken(context.Background(), token)
+    err = cfg.deleteChirp(chirp.ID)
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Token did not exists")
+        respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
         return
     }
+    cfg.publishEvent(events.ChirpDeleted, chirp.ID, DeletedChirp{ID: chirp.ID, UserID: chirp.UserID})
 
     respondWithJSON(w, http.StatusNoContent, nil)
     return
 }
 
-func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request) {
-    token, err := auth.GetBearerToken(r.Header)
+// deleteChirp removes a chirp outright when nothing replies to or quotes it.
+// Otherwise it is tombstoned so threads and quotes stay intact. Rechirps of
+// the chirp are removed either way.
+func (cfg *apiConfig) deleteChirp(chirpID uuid.UUID) error {
+    attachments, err := cfg.db.ListMediaAttachmentsByChirpIDs(context.Background(), []uuid.UUID{chirpID})
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Failed to get token")
-        return
+        return err
     }
 
-    userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+    _, err = cfg.db.DeleteChirpIfUnreferenced(context.Background(), chirpID)
+    if errors.Is(err, sql.ErrNoRows) {
+        err = cfg.db.TombstoneChirp(context.Background(), chirpID)
+    }
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Token missmatch on validation")
-        return
+        return err
     }
 
-    type newData struct {
-        Email string `json:"email"`
-        Password string `json:"password"`
+    // Either way the attachment rows are gone, so the blobs can follow.
+    for _, attachment := range attachments {
+        cfg.deleteBlobs(attachment.BlobKey, attachment.ThumbnailKey)
     }
 
-    decoder := json.NewDecoder(r.Body)
-    reqData := newData{}
-    err = decoder.Decode(&reqData)
+    return nil
+}
+
+// deleteBlobs removes stored media, logging failures since the rows that
+// pointed at the blobs are already gone.
+func (cfg *apiConfig) deleteBlobs(keys ...string) {
+    for _, key := range keys {
+        err := cfg.blobs.Delete(context.Background(), key)
+        if err != nil {
+            log.Printf("Failed to delete blob %s: %v", key, err)
+        }
+    }
+}
+
+func (cfg *apiConfig) moderateDeleteChirpHandler(w http.ResponseWriter, r *http.Request) {
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to decode input")
+        respondWithError(w, http.StatusBadRequest, "Failed to parse chirp id")
         return
     }
 
-    hashedPassword, err := auth.HashPassword(reqData.Password)
+    chirp, err := cfg.db.GetChirpByID(context.Background(), chirpID)
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+        respondWithError(w, http.StatusNotFound, "Failed to fetch chirp")
+        return
     }
 
-    newUserData, err := cfg.db.UpdateUserByID(context.Background(), database.UpdateUserByIDParams{
-        ID: userID,
-        Email: reqData.Email,
-        HashedPassword: hashedPassword,
-    })
+    if chirp.DeletedAt.Valid {
+        respondWithError(w, http.StatusNotFound, "Chirp not found")
+        return
+    }
 
-    newUser := User{
-        ID: newUserData.ID,
-        CreatedAt: newUserData.CreatedAt,
-        UpdatedAt: newUserData.UpdatedAt,
-        Email: newUserData.Email,
-        IsChirpyRed: newUserData.IsChirpyRed,
+    err = cfg.deleteChirp(chirp.ID)
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
+        return
     }
+    cfg.publishEvent(events.ChirpDeleted, chirp.ID, DeletedChirp{ID: chirp.ID, UserID: chirp.UserID})
 
-    respondWithJSON(w, http.StatusOK, newUser)
+    log.Printf("Moderator %v deleted chirp %v by user %v", userIDFromContext(r.Context()), chirp.ID, chirp.UserID)
+
+    respondWithJSON(w, http.StatusNoContent, nil)
     return
 }
 
-func (cfg *apiConfig) deleteChirpByIDHandler (w http.ResponseWriter, r *http.Request) {
-    stringID := r.PathValue("chirpID")
-    chirpID, err := uuid.Parse(stringID)
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to parse chirp id")
-    }
-    chirp, err := cfg.db.GetChirpByID(context.Background(), chirpID)
+func (cfg *apiConfig) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+    userID, err := uuid.Parse(r.PathValue("id"))
     if err != nil {
-        respondWithError(w, http.StatusNotFound, "Failed to fetch chirp")
+        respondWithError(w, http.StatusBadRequest, "Failed to parse user id")
         return
     }
 
-    token, err := auth.GetBearerToken(r.Header)
+    type reqStruct struct {
+        Role auth.Role `json:"role"`
+    }
+
+    decoder := json.NewDecoder(r.Body)
+    reqData := reqStruct{}
+    err = decoder.Decode(&reqData)
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Failed to get token")
+        respondWithError(w, http.StatusBadRequest, "Failed to decode input")
         return
     }
 
-    userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-    if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Token missmatch")
+    if !reqData.Role.Valid() {
+        respondWithError(w, http.StatusBadRequest, "Unknown role")
         return
     }
 
-    if userID != chirp.UserID {
-        respondWithError(w, http.StatusForbidden, "User unauthorized")
+    if userID == userIDFromContext(r.Context()) && reqData.Role != auth.RoleAdmin {
+        respondWithError(w, http.StatusBadRequest, "Admins cannot demote themselves")
         return
     }
 
-    err = cfg.db.DeleteChirpByID(context.Background(), chirp.ID)
+    user, err := cfg.db.SetUserRole(context.Background(), database.SetUserRoleParams{
+        ID: userID,
+        Role: string(reqData.Role),
+    })
     if err != nil {
-        respondWithError(w, http.StatusNotFound, "Chirp not found")
+        respondWithError(w, http.StatusNotFound, "User not found")
         return
     }
 
-    respondWithJSON(w, http.StatusNoContent, nil)
+    updatedUser := User{
+        ID: user.ID,
+        CreatedAt: user.CreatedAt,
+        UpdatedAt: user.UpdatedAt,
+        Email: user.Email,
+        IsChirpyRed: user.IsChirpyRed,
+        EmailVerified: user.EmailVerifiedAt.Valid,
+        Role: user.Role,
+        Handle: user.Handle,
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarURL: user.AvatarUrl,
+    }
+
+    respondWithJSON(w, http.StatusOK, updatedUser)
     return
 }
 
+const (
+    polkaProvider = "polka"
+    polkaSignatureHeader = "X-Polka-Signature"
+    maxPolkaBodyBytes = 64 << 10
+)
+
+// upgradeUserHandler applies Polka payment events. Requests must carry a
+// fresh signature from one of the configured keys, and each event id is
+// recorded so Polka's redeliveries are acknowledged without being reapplied.
 func (cfg *apiConfig) upgradeUserHandler(w http.ResponseWriter, r *http.Request) {
-    apiKey, err := auth.GetAPIKey(r.Header)
+    body, err := io.ReadAll(io.LimitReader(r.Body, maxPolkaBodyBytes))
     if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+        respondWithError(w, http.StatusBadRequest, "Failed to read request")
         return
     }
 
-    if apiKey != cfg.polkaKey {
+    err = auth.VerifyWebhookSignature(r.Header.Get(polkaSignatureHeader), body, cfg.polkaKeys, time.Now(), auth.DefaultWebhookTolerance)
+    if err != nil {
         respondWithError(w, http.StatusUnauthorized, "Unauthorized")
         return
     }
 
     type webReq struct {
+        ID string `json:"id"`
         Event string `json:"event"`
         Data struct {
             UserID string `json:"user_id"`
         } `json:"data"`
     }
 
-    decoder := json.NewDecoder(r.Body)
     reqData := webReq{}
-    err = decoder.Decode(&reqData)
+    err = json.Unmarshal(body, &reqData)
     if err != nil {
         respondWithError(w, http.StatusInternalServerError, "Failed to decode request")
         return
     }
+    if reqData.ID == "" {
+        respondWithError(w, http.StatusBadRequest, "Event id is required")
+        return
+    }
 
     userID, err := uuid.Parse(reqData.Data.UserID)
     if err != nil {
@@ -500,16 +4120,43 @@ func (cfg *apiConfig) upgradeUserHandler(w http.ResponseWriter, r *http.Request)
         return
     }
 
-    if reqData.Event != "user.upgraded" {
-        respondWithJSON(w, http.StatusNoContent, nil)
-        return
+    event := database.RecordWebhookEventParams{
+        Provider: polkaProvider,
+        EventID: reqData.ID,
+        EventType: reqData.Event,
     }
+    // Recording the event and applying it share a transaction, so a failed
+    // upgrade leaves the event unrecorded and Polka's retry is processed.
+    var recorded int64
+    err = cfg.inTx(func(q *database.Queries) error {
+        var err error
+        recorded, err = q.RecordWebhookEvent(context.Background(), event)
+        if err != nil || recorded == 0 || reqData.Event != "user.upgraded" {
+            return err
+        }
 
-    err = cfg.db.UpgradeUserRedChirpy(context.Background(), userID)
-    if err != nil {
+        upgraded, err := q.UpgradeUserRedChirpy(context.Background(), userID)
+        if err != nil {
+            return err
+        }
+        if upgraded == 0 {
+            return sql.ErrNoRows
+        }
+        return nil
+    })
+    if errors.Is(err, sql.ErrNoRows) {
         respondWithError(w, http.StatusNotFound, "User not found")
         return
     }
+    if err != nil {
+        respondWithError(w, http.StatusInternalServerError, "Failed to upgrade user")
+        return
+    }
+    if recorded == 0 || reqData.Event != "user.upgraded" {
+        respondWithJSON(w, http.StatusNoContent, nil)
+        return
+    }
+    cfg.publishEvent(events.UserUpgraded, userID, UserUpgraded{UserID: userID})
 
     respondWithJSON(w, http.StatusNoContent, nil)
     return
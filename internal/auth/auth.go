@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -10,37 +11,109 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func HashPassword(password string) (string, error) {
-    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-    if err != nil {
-        return "", err
+    return DefaultHasher.Hash(password)
+}
+
+func CheckPasswordHash(hash, password string) error {
+    return DefaultHasher.Verify(hash, password)
+}
+
+func PasswordNeedsRehash(hash string) bool {
+    return DefaultHasher.NeedsRehash(hash)
+}
+
+const EmailVerificationAudience = "chirpy-email-verification"
+
+// AccessClaims are the claims of an access token. Role is a snapshot taken
+// at issue time, so a role change takes effect once the token is refreshed.
+type AccessClaims struct {
+    Role Role `json:"role,omitempty"`
+    jwt.RegisteredClaims
+}
+
+func MakeJWT(userID uuid.UUID, role Role, keys *KeySet, expiresIn time.Duration) (string, error) {
+    claims := &AccessClaims{
+        Role: role,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Issuer: "chirpy",
+            IssuedAt: jwt.NewNumericDate(time.Now()),
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+            Subject: userID.String(),
+        },
     }
 
-    return string(hash), nil
+    return signToken(claims, keys)
 }
 
-func CheckPasswordHash(hash, password string) error {
-    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+    userID, _, err := ValidateAccessToken(tokenString, keys)
+    return userID, err
+}
+
+// ValidateAccessToken returns the user and role an access token was issued for.
+func ValidateAccessToken(tokenString string, keys *KeySet) (uuid.UUID, Role, error) {
+    claims := &AccessClaims{}
+    err := parseToken(tokenString, claims, keys)
     if err != nil {
-        return err
+        return uuid.Nil, "", err
     }
 
-    return nil
+    // Purpose-bound tokens carry an audience and must not work as access tokens.
+    if len(claims.Audience) != 0 {
+        return uuid.Nil, "", errors.New("Token is not an access token")
+    }
+
+    userID, err := uuid.Parse(claims.Subject)
+    if err != nil {
+        return uuid.Nil, "", err
+    }
+
+    return userID, claims.Role, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// MakeEmailVerificationToken signs a token for userID whose jti is tokenID,
+// so the caller can record it and enforce single use.
+func MakeEmailVerificationToken(userID, tokenID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
     claims := &jwt.RegisteredClaims{
         Issuer: "chirpy",
+        Audience: jwt.ClaimStrings{EmailVerificationAudience},
         IssuedAt: jwt.NewNumericDate(time.Now()),
         ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
         Subject: userID.String(),
+        ID: tokenID.String(),
+    }
+
+    return signToken(claims, keys)
+}
+
+func ValidateEmailVerificationToken(tokenString string, keys *KeySet) (uuid.UUID, uuid.UUID, error) {
+    claims := &jwt.RegisteredClaims{}
+    err := parseToken(tokenString, claims, keys, jwt.WithAudience(EmailVerificationAudience))
+    if err != nil {
+        return uuid.Nil, uuid.Nil, err
+    }
+
+    userID, err := uuid.Parse(claims.Subject)
+    if err != nil {
+        return uuid.Nil, uuid.Nil, err
     }
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    ss, err := token.SignedString([]byte(tokenSecret))
+    tokenID, err := uuid.Parse(claims.ID)
+    if err != nil {
+        return uuid.Nil, uuid.Nil, err
+    }
+
+    return userID, tokenID, nil
+}
+
+func signToken(claims jwt.Claims, keys *KeySet) (string, error) {
+    signingKey := keys.Active()
+    token := jwt.NewWithClaims(signingKey.Method, claims)
+    token.Header["kid"] = signingKey.ID
+    ss, err := token.SignedString(signingKey.Private)
     if err != nil {
         return "", err
     }
@@ -48,22 +121,35 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
     return ss, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-    token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(tokenSecret), nil
-    })
+func parseToken(tokenString string, claims jwt.Claims, keys *KeySet, options ...jwt.ParserOption) error {
+    options = append(options, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 
-    if err != nil || !token.Valid{
-        return uuid.Nil, err
-    }
+    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        kid, ok := token.Header["kid"].(string)
+        if !ok {
+            return nil, errors.New("Token has no key id")
+        }
+
+        signingKey, ok := keys.Lookup(kid)
+        if !ok {
+            return nil, errors.New("Token signed with unknown key")
+        }
+
+        if token.Method.Alg() != signingKey.Method.Alg() {
+            return nil, errors.New("Token algorithm does not match its key")
+        }
+
+        return signingKey.Public, nil
+    }, options...)
 
-    subject, _ := token.Claims.GetSubject()
-    userID, err := uuid.Parse(subject)
     if err != nil {
-        return uuid.Nil, err
+        return err
+    }
+    if !token.Valid {
+        return errors.New("Token is invalid")
     }
 
-    return userID, nil
+    return nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -92,16 +178,9 @@ func MakeRefreshToken() (string, error) {
     return hexStr, nil
 }
 
-func GetAPIKey(headers http.Header) (string, error) {
-    authHead := headers.Get("Authorization")
-    if authHead == "" {
-        return "", errors.New("Authorization header is missing")
-    }
-
-    if !strings.HasPrefix(authHead, "ApiKey ") {
-        return "", errors.New("ApiKey is missing")
-    }
-
-    apiKey := strings.TrimPrefix(authHead, "ApiKey ")
-    return apiKey, nil
+// HashToken returns the hex SHA-256 of a random opaque token so it can be
+// stored and looked up without keeping the token itself.
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
 }
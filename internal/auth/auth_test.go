@@ -21,14 +21,17 @@ func TestHash(t *testing.T) {
 
 func TestJWT(t *testing.T) {
     id, _ := uuid.NewRandom()
-    secret := "ASecretString"
+    keys, err := NewEphemeralKeySet()
+    if err != nil {
+        t.Fatalf("Failed to create keys: %v", err)
+    }
     expires := 24 * time.Hour
-    token, err := MakeJWT(id, secret, expires)
+    token, err := MakeJWT(id, RoleUser, keys, expires)
     if err != nil {
         t.Errorf("Failed to create token: %v", err)
     }
 
-    procID, err := ValidateJWT(token, secret)
+    procID, err := ValidateJWT(token, keys)
     if err != nil {
         t.Errorf("Failed to validate JWT: %v", err)
     }
@@ -37,3 +40,75 @@ func TestJWT(t *testing.T) {
         t.Errorf("JWT changes ID from %v to %v", id, procID)
     }
 }
+
+func TestEmailVerificationToken(t *testing.T) {
+    keys, err := NewEphemeralKeySet()
+    if err != nil {
+        t.Fatalf("Failed to create keys: %v", err)
+    }
+    userID := uuid.New()
+    tokenID := uuid.New()
+
+    token, err := MakeEmailVerificationToken(userID, tokenID, keys, time.Hour)
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+
+    procUserID, procTokenID, err := ValidateEmailVerificationToken(token, keys)
+    if err != nil {
+        t.Fatalf("Failed to validate token: %v", err)
+    }
+    if procUserID != userID || procTokenID != tokenID {
+        t.Errorf("Token changed ids to %v, %v", procUserID, procTokenID)
+    }
+
+    _, err = ValidateJWT(token, keys)
+    if err == nil {
+        t.Errorf("Verification token should not be accepted as access token")
+    }
+
+    accessToken, err := MakeJWT(userID, RoleUser, keys, time.Hour)
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+    _, _, err = ValidateEmailVerificationToken(accessToken, keys)
+    if err == nil {
+        t.Errorf("Access token should not be accepted as verification token")
+    }
+}
+
+func TestHashToken(t *testing.T) {
+    token, err := MakeRefreshToken()
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+
+    hashed := HashToken(token)
+    if hashed == token || len(hashed) != 64 {
+        t.Errorf("Unexpected token hash %q", hashed)
+    }
+    if HashToken(token) != hashed {
+        t.Errorf("Token hash is not deterministic")
+    }
+}
+
+func TestAccessTokenRole(t *testing.T) {
+    keys, err := NewEphemeralKeySet()
+    if err != nil {
+        t.Fatalf("Failed to create keys: %v", err)
+    }
+    id := uuid.New()
+
+    token, err := MakeJWT(id, RoleModerator, keys, time.Hour)
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+
+    procID, role, err := ValidateAccessToken(token, keys)
+    if err != nil {
+        t.Fatalf("Failed to validate token: %v", err)
+    }
+    if procID != id || role != RoleModerator {
+        t.Errorf("Token changed claims to %v %q", procID, role)
+    }
+}
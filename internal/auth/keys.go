@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one entry of a KeySet. Retired keys may only carry the
+// public half, in which case Private is nil and the key only verifies.
+type SigningKey struct {
+    ID string
+    Method jwt.SigningMethod
+    Private crypto.Signer
+    Public crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens plus every key whose tokens
+// are still accepted.
+type KeySet struct {
+    active *SigningKey
+    keys map[string]*SigningKey
+}
+
+type JWK struct {
+    Kty string `json:"kty"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    Kid string `json:"kid"`
+    Crv string `json:"crv,omitempty"`
+    X string `json:"x,omitempty"`
+    N string `json:"n,omitempty"`
+    E string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+    Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet reads every <kid>.pem file in dir. Files may hold a PKCS#8
+// private key or a PKIX public key; RSA keys sign with RS256 and Ed25519
+// keys with EdDSA. The key named activeKID must have its private half.
+func LoadKeySet(dir, activeKID string) (*KeySet, error) {
+    paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+    if err != nil {
+        return nil, err
+    }
+
+    var keys []*SigningKey
+    for _, path := range paths {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+
+        kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+        key, err := ParseSigningKey(kid, data)
+        if err != nil {
+            return nil, fmt.Errorf("Failed to load key %s: %w", path, err)
+        }
+        keys = append(keys, key)
+    }
+
+    return NewKeySet(activeKID, keys...)
+}
+
+func NewKeySet(activeKID string, keys ...*SigningKey) (*KeySet, error) {
+    keySet := &KeySet{
+        keys: make(map[string]*SigningKey),
+    }
+
+    for _, key := range keys {
+        if _, exists := keySet.keys[key.ID]; exists {
+            return nil, fmt.Errorf("Duplicate key id %q", key.ID)
+        }
+        keySet.keys[key.ID] = key
+    }
+
+    active, ok := keySet.keys[activeKID]
+    if !ok {
+        return nil, fmt.Errorf("Active key %q not found", activeKID)
+    }
+    if active.Private == nil {
+        return nil, fmt.Errorf("Active key %q has no private key", activeKID)
+    }
+    keySet.active = active
+
+    return keySet, nil
+}
+
+// NewEphemeralKeySet generates a throwaway Ed25519 key. Tokens signed with it
+// do not survive a restart, so it is only meant for local development.
+func NewEphemeralKeySet() (*KeySet, error) {
+    _, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+
+    return NewKeySet("ephemeral", &SigningKey{
+        ID: "ephemeral",
+        Method: jwt.SigningMethodEdDSA,
+        Private: private,
+        Public: private.Public(),
+    })
+}
+
+func ParseSigningKey(kid string, data []byte) (*SigningKey, error) {
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, errors.New("No PEM block found")
+    }
+
+    key := &SigningKey{
+        ID: kid,
+    }
+
+    switch block.Type {
+    case "PRIVATE KEY":
+        parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+        if err != nil {
+            return nil, err
+        }
+        signer, ok := parsed.(crypto.Signer)
+        if !ok {
+            return nil, errors.New("Private key cannot sign")
+        }
+        key.Private = signer
+        key.Public = signer.Public()
+    case "PUBLIC KEY":
+        parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+            return nil, err
+        }
+        key.Public = parsed
+    default:
+        return nil, fmt.Errorf("Unsupported PEM block %q", block.Type)
+    }
+
+    switch key.Public.(type) {
+    case *rsa.PublicKey:
+        key.Method = jwt.SigningMethodRS256
+    case ed25519.PublicKey:
+        key.Method = jwt.SigningMethodEdDSA
+    default:
+        return nil, errors.New("Only RSA and Ed25519 keys are supported")
+    }
+
+    return key, nil
+}
+
+func (ks *KeySet) Active() *SigningKey {
+    return ks.active
+}
+
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+    key, ok := ks.keys[kid]
+    return key, ok
+}
+
+// JWKS returns the public half of every key, sorted by key id.
+func (ks *KeySet) JWKS() JWKS {
+    jwks := JWKS{
+        Keys: []JWK{},
+    }
+
+    for _, key := range ks.keys {
+        jwk := JWK{
+            Use: "sig",
+            Alg: key.Method.Alg(),
+            Kid: key.ID,
+        }
+
+        switch public := key.Public.(type) {
+        case *rsa.PublicKey:
+            jwk.Kty = "RSA"
+            jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+            jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+        case ed25519.PublicKey:
+            jwk.Kty = "OKP"
+            jwk.Crv = "Ed25519"
+            jwk.X = base64.RawURLEncoding.EncodeToString(public)
+        }
+
+        jwks.Keys = append(jwks.Keys, jwk)
+    }
+
+    sort.Slice(jwks.Keys, func(i, j int) bool {
+        return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+    })
+
+    return jwks
+}
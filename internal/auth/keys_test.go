@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key interface{}) {
+    der, err := x509.MarshalPKCS8PrivateKey(key)
+    if err != nil {
+        t.Fatalf("Failed to marshal key: %v", err)
+    }
+
+    data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+    err = os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600)
+    if err != nil {
+        t.Fatalf("Failed to write key: %v", err)
+    }
+}
+
+func TestKeyRotation(t *testing.T) {
+    dir := t.TempDir()
+
+    rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("Failed to generate RSA key: %v", err)
+    }
+    writePrivateKey(t, dir, "old", rsaKey)
+
+    _, edKey, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("Failed to generate Ed25519 key: %v", err)
+    }
+    writePrivateKey(t, dir, "new", edKey)
+
+    oldKeys, err := LoadKeySet(dir, "old")
+    if err != nil {
+        t.Fatalf("Failed to load key set: %v", err)
+    }
+    id := uuid.New()
+    oldToken, err := MakeJWT(id, RoleUser, oldKeys, time.Hour)
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+
+    newKeys, err := LoadKeySet(dir, "new")
+    if err != nil {
+        t.Fatalf("Failed to load key set: %v", err)
+    }
+    if newKeys.Active().Method.Alg() != "EdDSA" {
+        t.Errorf("Expected EdDSA active key, got %s", newKeys.Active().Method.Alg())
+    }
+
+    procID, err := ValidateJWT(oldToken, newKeys)
+    if err != nil {
+        t.Errorf("Retired key should still validate: %v", err)
+    }
+    if procID != id {
+        t.Errorf("JWT changes ID from %v to %v", id, procID)
+    }
+
+    otherKeys, err := NewEphemeralKeySet()
+    if err != nil {
+        t.Fatalf("Failed to create keys: %v", err)
+    }
+    _, err = ValidateJWT(oldToken, otherKeys)
+    if err == nil {
+        t.Errorf("Token with unknown key id should not validate")
+    }
+}
+
+func TestJWKS(t *testing.T) {
+    dir := t.TempDir()
+
+    rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("Failed to generate RSA key: %v", err)
+    }
+    writePrivateKey(t, dir, "a", rsaKey)
+
+    edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("Failed to generate Ed25519 key: %v", err)
+    }
+    der, err := x509.MarshalPKIXPublicKey(edPublic)
+    if err != nil {
+        t.Fatalf("Failed to marshal public key: %v", err)
+    }
+    data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+    err = os.WriteFile(filepath.Join(dir, "b.pem"), data, 0600)
+    if err != nil {
+        t.Fatalf("Failed to write key: %v", err)
+    }
+
+    keys, err := LoadKeySet(dir, "a")
+    if err != nil {
+        t.Fatalf("Failed to load key set: %v", err)
+    }
+
+    jwks := keys.JWKS()
+    if len(jwks.Keys) != 2 {
+        t.Fatalf("Expected 2 keys, got %d", len(jwks.Keys))
+    }
+    if jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].Alg != "RS256" || jwks.Keys[0].E != "AQAB" {
+        t.Errorf("Unexpected RSA JWK: %+v", jwks.Keys[0])
+    }
+    if jwks.Keys[1].Kty != "OKP" || jwks.Keys[1].Crv != "Ed25519" || jwks.Keys[1].X == "" {
+        t.Errorf("Unexpected Ed25519 JWK: %+v", jwks.Keys[1])
+    }
+
+    _, err = LoadKeySet(dir, "b")
+    if err == nil {
+        t.Errorf("Public-only key should not be accepted as active")
+    }
+}
@@ -0,0 +1,77 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long a login subject (an account or a client IP)
+// must wait after a run of failed attempts. The first FreeAttempts failures
+// cost nothing, later ones back off exponentially from BaseDelay up to
+// MaxDelay, and MaxFailures locks the subject out for LockoutDuration.
+// Failures older than ResetAfter no longer count.
+type LockoutPolicy struct {
+    FreeAttempts int
+    BaseDelay time.Duration
+    MaxDelay time.Duration
+    MaxFailures int
+    LockoutDuration time.Duration
+    ResetAfter time.Duration
+}
+
+var DefaultAccountLockout = LockoutPolicy{
+    FreeAttempts: 2,
+    BaseDelay: 1 * time.Second,
+    MaxDelay: 1 * time.Minute,
+    MaxFailures: 10,
+    LockoutDuration: 15 * time.Minute,
+    ResetAfter: 1 * time.Hour,
+}
+
+// DefaultIPLockout is looser since many users can share one address.
+var DefaultIPLockout = LockoutPolicy{
+    FreeAttempts: 10,
+    BaseDelay: 1 * time.Second,
+    MaxDelay: 1 * time.Minute,
+    MaxFailures: 50,
+    LockoutDuration: 15 * time.Minute,
+    ResetAfter: 1 * time.Hour,
+}
+
+// DefaultResetAccountLimit spaces out password reset mail to one address so
+// the endpoint cannot be used to flood an inbox.
+var DefaultResetAccountLimit = LockoutPolicy{
+    FreeAttempts: 3,
+    BaseDelay: 1 * time.Minute,
+    MaxDelay: 30 * time.Minute,
+    MaxFailures: 10,
+    LockoutDuration: 24 * time.Hour,
+    ResetAfter: 24 * time.Hour,
+}
+
+// DefaultResetIPLimit caps how many reset mails a single client can trigger.
+var DefaultResetIPLimit = LockoutPolicy{
+    FreeAttempts: 10,
+    BaseDelay: 1 * time.Second,
+    MaxDelay: 1 * time.Minute,
+    MaxFailures: 30,
+    LockoutDuration: 1 * time.Hour,
+    ResetAfter: 1 * time.Hour,
+}
+
+// RetryAt returns the earliest time the next attempt is allowed.
+func (p LockoutPolicy) RetryAt(failures int, lastFailure time.Time) time.Time {
+    if failures >= p.MaxFailures {
+        return lastFailure.Add(p.LockoutDuration)
+    }
+    if failures <= p.FreeAttempts {
+        return lastFailure
+    }
+
+    delay := p.BaseDelay
+    for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+        delay *= 2
+    }
+    if delay > p.MaxDelay {
+        delay = p.MaxDelay
+    }
+
+    return lastFailure.Add(delay)
+}
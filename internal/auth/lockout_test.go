@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+    policy := LockoutPolicy{
+        FreeAttempts: 2,
+        BaseDelay: 1 * time.Second,
+        MaxDelay: 5 * time.Second,
+        MaxFailures: 8,
+        LockoutDuration: 15 * time.Minute,
+    }
+    last := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+    cases := []struct {
+        failures int
+        wait time.Duration
+    }{
+        {1, 0},
+        {2, 0},
+        {3, 1 * time.Second},
+        {4, 2 * time.Second},
+        {5, 4 * time.Second},
+        {6, 5 * time.Second},
+        {7, 5 * time.Second},
+        {8, 15 * time.Minute},
+    }
+
+    for _, c := range cases {
+        got := policy.RetryAt(c.failures, last).Sub(last)
+        if got != c.wait {
+            t.Errorf("After %d failures expected wait %v, got %v", c.failures, c.wait, got)
+        }
+    }
+}
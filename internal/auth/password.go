@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("Password does not match hash")
+
+// PasswordHasher produces and checks stored password hashes. NeedsRehash
+// reports whether a hash that verified should be replaced with a fresh one.
+type PasswordHasher interface {
+    Hash(password string) (string, error)
+    Verify(hash, password string) error
+    NeedsRehash(hash string) bool
+}
+
+type Argon2idParams struct {
+    Memory uint32
+    Iterations uint32
+    Parallelism uint8
+    SaltLength uint32
+    KeyLength uint32
+}
+
+// DefaultArgon2idParams follows the OWASP minimum recommendation.
+var DefaultArgon2idParams = Argon2idParams{
+    Memory: 19 * 1024,
+    Iterations: 2,
+    Parallelism: 1,
+    SaltLength: 16,
+    KeyLength: 32,
+}
+
+// DefaultHasher backs HashPassword and CheckPasswordHash.
+var DefaultHasher PasswordHasher = &Argon2idHasher{Params: DefaultArgon2idParams}
+
+// Argon2idHasher writes PHC-format argon2id hashes and still accepts legacy
+// bcrypt hashes, flagging them for rehash.
+type Argon2idHasher struct {
+    Params Argon2idParams
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+    salt := make([]byte, h.Params.SaltLength)
+    _, err := rand.Read(salt)
+    if err != nil {
+        return "", err
+    }
+
+    key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+        argon2.Version,
+        h.Params.Memory,
+        h.Params.Iterations,
+        h.Params.Parallelism,
+        base64.RawStdEncoding.EncodeToString(salt),
+        base64.RawStdEncoding.EncodeToString(key),
+    ), nil
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) error {
+    if isBcryptHash(hash) {
+        err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+        if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+            return ErrPasswordMismatch
+        }
+        return err
+    }
+
+    params, salt, key, err := decodeArgon2idHash(hash)
+    if err != nil {
+        return err
+    }
+
+    otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+    if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+        return ErrPasswordMismatch
+    }
+
+    return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+    params, salt, _, err := decodeArgon2idHash(hash)
+    if err != nil {
+        return true
+    }
+
+    return params.Memory != h.Params.Memory ||
+        params.Iterations != h.Params.Iterations ||
+        params.Parallelism != h.Params.Parallelism ||
+        params.KeyLength != h.Params.KeyLength ||
+        uint32(len(salt)) != h.Params.SaltLength
+}
+
+func isBcryptHash(hash string) bool {
+    return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2idHash(hash string) (Argon2idParams, []byte, []byte, error) {
+    parts := strings.Split(hash, "$")
+    if len(parts) != 6 || parts[1] != "argon2id" {
+        return Argon2idParams{}, nil, nil, errors.New("Unsupported password hash format")
+    }
+
+    var version int
+    _, err := fmt.Sscanf(parts[2], "v=%d", &version)
+    if err != nil {
+        return Argon2idParams{}, nil, nil, err
+    }
+    if version != argon2.Version {
+        return Argon2idParams{}, nil, nil, errors.New("Unsupported argon2 version")
+    }
+
+    params := Argon2idParams{}
+    _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+    if err != nil {
+        return Argon2idParams{}, nil, nil, err
+    }
+
+    salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+    if err != nil {
+        return Argon2idParams{}, nil, nil, err
+    }
+    params.SaltLength = uint32(len(salt))
+
+    key, err := base64.RawStdEncoding.DecodeString(parts[5])
+    if err != nil {
+        return Argon2idParams{}, nil, nil, err
+    }
+    params.KeyLength = uint32(len(key))
+
+    return params, salt, key, nil
+}
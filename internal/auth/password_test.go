@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2idHash(t *testing.T) {
+    hasher := &Argon2idHasher{Params: DefaultArgon2idParams}
+    password := strings.Repeat("long-password-", 8)
+
+    hashed, err := hasher.Hash(password)
+    if err != nil {
+        t.Fatalf("Hashing error: %v", err)
+    }
+    if !strings.HasPrefix(hashed, "$argon2id$v=19$m=19456,t=2,p=1$") {
+        t.Errorf("Unexpected hash format: %s", hashed)
+    }
+
+    err = hasher.Verify(hashed, password)
+    if err != nil {
+        t.Errorf("Validate hash error: %v", err)
+    }
+
+    // bcrypt would accept this since it only looks at the first 72 bytes.
+    err = hasher.Verify(hashed, password[:72])
+    if !errors.Is(err, ErrPasswordMismatch) {
+        t.Errorf("Expected mismatch for truncated password, got %v", err)
+    }
+
+    if hasher.NeedsRehash(hashed) {
+        t.Errorf("Fresh hash should not need rehash")
+    }
+
+    stronger := &Argon2idHasher{Params: DefaultArgon2idParams}
+    stronger.Params.Iterations = 3
+    if !stronger.NeedsRehash(hashed) {
+        t.Errorf("Hash with outdated parameters should need rehash")
+    }
+}
+
+func TestLegacyBcryptHash(t *testing.T) {
+    hasher := &Argon2idHasher{Params: DefaultArgon2idParams}
+    password := "VerySecret"
+
+    legacy, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        t.Fatalf("Hashing error: %v", err)
+    }
+
+    err = hasher.Verify(string(legacy), password)
+    if err != nil {
+        t.Errorf("Legacy hash should verify: %v", err)
+    }
+
+    err = hasher.Verify(string(legacy), "WrongSecret")
+    if !errors.Is(err, ErrPasswordMismatch) {
+        t.Errorf("Expected mismatch, got %v", err)
+    }
+
+    if !hasher.NeedsRehash(string(legacy)) {
+        t.Errorf("Legacy hash should need rehash")
+    }
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access
+// tokens rather than JWTs, so they can be told apart without a lookup.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+const (
+    ScopeChirpsRead = "chirps:read"
+    ScopeChirpsWrite = "chirps:write"
+    ScopeUsersWrite = "users:write"
+)
+
+var validScopes = []string{
+    ScopeChirpsRead,
+    ScopeChirpsWrite,
+    ScopeUsersWrite,
+}
+
+func MakePersonalAccessToken() (string, error) {
+    token, err := MakeRefreshToken()
+    if err != nil {
+        return "", err
+    }
+
+    return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+    return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+func ValidScope(scope string) bool {
+    return slices.Contains(validScopes, scope)
+}
+
+func HasScope(scopes []string, scope string) bool {
+    return slices.Contains(scopes, scope)
+}
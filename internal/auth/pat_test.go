@@ -0,0 +1,32 @@
+package auth
+
+import "testing"
+
+func TestPersonalAccessToken(t *testing.T) {
+    token, err := MakePersonalAccessToken()
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+    if !IsPersonalAccessToken(token) {
+        t.Errorf("Token %q is missing its prefix", token)
+    }
+
+    refreshToken, err := MakeRefreshToken()
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+    if IsPersonalAccessToken(refreshToken) {
+        t.Errorf("Refresh token should not look like a personal access token")
+    }
+}
+
+func TestScopes(t *testing.T) {
+    if !ValidScope(ScopeChirpsWrite) || ValidScope("chirps:admin") {
+        t.Errorf("Unexpected scope validation result")
+    }
+
+    scopes := []string{ScopeChirpsRead}
+    if !HasScope(scopes, ScopeChirpsRead) || HasScope(scopes, ScopeChirpsWrite) {
+        t.Errorf("Unexpected scope check result")
+    }
+}
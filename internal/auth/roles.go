@@ -0,0 +1,33 @@
+package auth
+
+// Role is a user's authorization level. Each role includes every permission
+// of the roles below it.
+type Role string
+
+const (
+    RoleUser Role = "user"
+    RoleModerator Role = "moderator"
+    RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+    RoleUser: 1,
+    RoleModerator: 2,
+    RoleAdmin: 3,
+}
+
+func (r Role) Valid() bool {
+    _, ok := roleRanks[r]
+    return ok
+}
+
+// AtLeast reports whether r grants everything required does. Unknown roles
+// grant nothing.
+func (r Role) AtLeast(required Role) bool {
+    rank, ok := roleRanks[r]
+    if !ok {
+        return false
+    }
+
+    return rank >= roleRanks[required]
+}
@@ -0,0 +1,24 @@
+package auth
+
+import "testing"
+
+func TestRoleAtLeast(t *testing.T) {
+    cases := []struct {
+        role Role
+        required Role
+        want bool
+    }{
+        {RoleAdmin, RoleModerator, true},
+        {RoleModerator, RoleModerator, true},
+        {RoleUser, RoleModerator, false},
+        {RoleModerator, RoleAdmin, false},
+        {Role(""), RoleUser, false},
+        {Role("root"), RoleUser, false},
+    }
+
+    for _, c := range cases {
+        if got := c.role.AtLeast(c.required); got != c.want {
+            t.Errorf("%q.AtLeast(%q) = %v, want %v", c.role, c.required, got, c.want)
+        }
+    }
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rfc6238Secret is the SHA1 seed from RFC 6238 appendix B.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+    cases := []struct {
+        unix int64
+        code string
+    }{
+        {59, "287082"},
+        {1111111109, "081804"},
+        {1111111111, "050471"},
+        {1234567890, "005924"},
+        {2000000000, "279037"},
+        {20000000000, "353130"},
+    }
+
+    for _, c := range cases {
+        code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(c.unix, 0)))
+        if err != nil {
+            t.Fatalf("Failed to compute code: %v", err)
+        }
+        if code != c.code {
+            t.Errorf("At %d expected %s, got %s", c.unix, c.code, code)
+        }
+    }
+}
+
+func TestValidateTOTP(t *testing.T) {
+    now := time.Unix(1111111111, 0)
+
+    step, ok := ValidateTOTP(rfc6238Secret, "050471", now)
+    if !ok || step != TOTPStep(now) {
+        t.Errorf("Current code should validate at step %d, got %d %v", TOTPStep(now), step, ok)
+    }
+
+    _, ok = ValidateTOTP(rfc6238Secret, "050471", now.Add(TOTPPeriod))
+    if !ok {
+        t.Errorf("Code from the previous period should be within skew")
+    }
+
+    _, ok = ValidateTOTP(rfc6238Secret, "050471", now.Add(3 * TOTPPeriod))
+    if ok {
+        t.Errorf("Stale code should not validate")
+    }
+
+    _, ok = ValidateTOTP(rfc6238Secret, "000000", now)
+    if ok {
+        t.Errorf("Wrong code should not validate")
+    }
+}
+
+func TestTOTPURI(t *testing.T) {
+    uri := TOTPURI("ABC", "Chirpy", "user@example.com")
+    if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") {
+        t.Errorf("Unexpected URI %s", uri)
+    }
+    if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=Chirpy") {
+        t.Errorf("URI is missing parameters: %s", uri)
+    }
+}
+
+func TestRecoveryCodes(t *testing.T) {
+    codes, err := GenerateRecoveryCodes(10)
+    if err != nil {
+        t.Fatalf("Failed to generate codes: %v", err)
+    }
+    if len(codes) != 10 {
+        t.Fatalf("Expected 10 codes, got %d", len(codes))
+    }
+
+    seen := map[string]bool{}
+    for _, code := range codes {
+        if len(code) != 11 || code[5] != '-' {
+            t.Errorf("Unexpected code format %q", code)
+        }
+        if seen[code] {
+            t.Errorf("Duplicate code %q", code)
+        }
+        seen[code] = true
+
+        typed := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+        if NormalizeRecoveryCode(typed) != code {
+            t.Errorf("Normalizing %q gave %q", typed, NormalizeRecoveryCode(typed))
+        }
+    }
+}
+
+func TestTwoFactorChallengeToken(t *testing.T) {
+    keys, err := NewEphemeralKeySet()
+    if err != nil {
+        t.Fatalf("Failed to create keys: %v", err)
+    }
+    userID := uuid.New()
+
+    token, err := MakeTwoFactorChallengeToken(userID, keys, 5 * time.Minute)
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+
+    procID, err := ValidateTwoFactorChallengeToken(token, keys)
+    if err != nil || procID != userID {
+        t.Errorf("Challenge token did not round trip: %v %v", procID, err)
+    }
+
+    _, err = ValidateJWT(token, keys)
+    if err == nil {
+        t.Errorf("Challenge token should not be accepted as access token")
+    }
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+    body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"x"}}`)
+    now := time.Unix(1700000000, 0)
+    keys := []string{"old-key", "new-key"}
+
+    sig := func(key string, ts int64) string {
+        return SignWebhook(key, ts, body)
+    }
+    ts := now.Unix()
+
+    cases := []struct {
+        name string
+        header string
+        body []byte
+        want error
+    }{
+        {"old key", fmt.Sprintf("t=%d,v1=%s", ts, sig("old-key", ts)), body, nil},
+        {"new key", fmt.Sprintf("t=%d,v1=%s", ts, sig("new-key", ts)), body, nil},
+        {"both keys", WebhookSignatureHeader(ts, body, "retired-key", "new-key"), body, nil},
+        {"within window", fmt.Sprintf("t=%d,v1=%s", ts-240, sig("old-key", ts-240)), body, nil},
+        {"missing", "", body, ErrWebhookSignatureMissing},
+        {"no timestamp", "v1=" + sig("old-key", ts), body, ErrWebhookSignatureMalformed},
+        {"no signature", fmt.Sprintf("t=%d", ts), body, ErrWebhookSignatureMalformed},
+        {"bad hex", fmt.Sprintf("t=%d,v1=zz", ts), body, ErrWebhookSignatureMalformed},
+        {"too old", fmt.Sprintf("t=%d,v1=%s", ts-600, sig("old-key", ts-600)), body, ErrWebhookTimestampOutOfRange},
+        {"too new", fmt.Sprintf("t=%d,v1=%s", ts+600, sig("old-key", ts+600)), body, ErrWebhookTimestampOutOfRange},
+        {"unknown key", fmt.Sprintf("t=%d,v1=%s", ts, sig("retired-key", ts)), body, ErrWebhookSignatureMismatch},
+        {"tampered body", fmt.Sprintf("t=%d,v1=%s", ts, sig("old-key", ts)), []byte(`{"id":"evt_2"}`), ErrWebhookSignatureMismatch},
+        {"timestamp swapped", fmt.Sprintf("t=%d,v1=%s", ts-1, sig("old-key", ts)), body, ErrWebhookSignatureMismatch},
+    }
+
+    for _, c := range cases {
+        err := VerifyWebhookSignature(c.header, c.body, keys, now, DefaultWebhookTolerance)
+        if !errors.Is(err, c.want) {
+            t.Errorf("%s: VerifyWebhookSignature() = %v, want %v", c.name, err, c.want)
+        }
+    }
+}
@@ -7,29 +7,111 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, repost_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+	RepostOf uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.RepostOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RepostOf,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, repost_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+ON CONFLICT (user_id, repost_of) WHERE repost_of IS NOT NULL AND body = '' AND deleted_at IS NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of
+`
+
+type CreateRechirpParams struct {
+	UserID   uuid.UUID
+	RepostOf uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RepostOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RepostOf,
+	)
+	return i, err
+}
+
+const createReply = `-- name: CreateReply :one
+WITH parent AS (
+    UPDATE chirps
+    SET reply_count = reply_count + 1
+    WHERE chirps.id = $1 AND chirps.deleted_at IS NULL
+    RETURNING chirps.id, COALESCE(chirps.root_id, chirps.id) AS root_id
+)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, parent_id, root_id)
+SELECT gen_random_uuid(), NOW(), NOW(), $2::text, $3::uuid, parent.id, parent.root_id
+FROM parent
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of
+`
+
+type CreateReplyParams struct {
+	ParentID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) CreateReply(ctx context.Context, arg CreateReplyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createReply, arg.ParentID, arg.Body, arg.UserID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,22 +119,84 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RepostOf,
 	)
 	return i, err
 }
 
-const deleteChirpByID = `-- name: DeleteChirpByID :exec
-DELETE FROM chirps
+const deleteChirpIfUnreferenced = `-- name: DeleteChirpIfUnreferenced :one
+WITH deleted AS (
+    DELETE FROM chirps
+    WHERE chirps.id = $1
+      AND chirps.reply_count = 0
+      AND NOT EXISTS (
+        SELECT 1 FROM chirps AS quotes
+        WHERE quotes.repost_of = chirps.id
+          AND (quotes.body <> '' OR quotes.deleted_at IS NOT NULL)
+      )
+    RETURNING chirps.id, chirps.parent_id
+), parent AS (
+    UPDATE chirps
+    SET reply_count = chirps.reply_count - 1
+    FROM deleted
+    WHERE chirps.id = deleted.parent_id
+)
+SELECT parent_id FROM deleted
+`
+
+func (q *Queries) DeleteChirpIfUnreferenced(ctx context.Context, id uuid.UUID) (uuid.NullUUID, error) {
+	row := q.db.QueryRowContext(ctx, deleteChirpIfUnreferenced, id)
+	var parent_id uuid.NullUUID
+	err := row.Scan(&parent_id)
+	return parent_id, err
+}
+
+const editChirp = `-- name: EditChirp :one
+WITH revision AS (
+    INSERT INTO chirp_revisions(id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, COALESCE(chirps.edited_at, chirps.created_at), NOW()
+    FROM chirps
+    WHERE chirps.id = $1
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW(), edited_at = NOW()
 WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of
 `
 
-func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirpByID, id)
-	return err
+type EditChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) EditChirp(ctx context.Context, arg EditChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, editChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RepostOf,
+	)
+	return i, err
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
 WHERE id = $1
 `
 
@@ -65,17 +209,257 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RepostOf,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+const getChirpRevisions = `-- name: GetChirpRevisions :many
+SELECT id, chirp_id, body, created_at, replaced_at FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC
+`
+
+func (q *Queries) GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE user_id = $1 AND repost_of = $2 AND body = '' AND deleted_at IS NULL
+`
+
+type GetRechirpParams struct {
+	UserID   uuid.UUID
+	RepostOf uuid.NullUUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RepostOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RepostOf,
+	)
+	return i, err
+}
+
+const listAncestors = `-- name: ListAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.parent_id AS id
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT chirps.parent_id
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+    WHERE chirps.parent_id IS NOT NULL
+)
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE id IN (SELECT id FROM ancestors)
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) ListAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RepostOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE deleted_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1)
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RepostOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByIDs = `-- name: ListChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) ListChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RepostOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE deleted_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1)
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) < ($2, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +473,13 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RepostOf,
 		); err != nil {
 			return nil, err
 		}
@@ -102,3 +493,146 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const listDescendants = `-- name: ListDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, 1 AS depth
+    FROM chirps
+    WHERE chirps.parent_id = ANY($1::uuid[])
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.parent_id = descendants.id
+    WHERE descendants.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE id IN (SELECT id FROM descendants)
+ORDER BY created_at ASC, id ASC
+LIMIT $3
+`
+
+type ListDescendantsParams struct {
+	ParentIds []uuid.UUID
+	MaxDepth  int32
+	Limit     int32
+}
+
+func (q *Queries) ListDescendants(ctx context.Context, arg ListDescendantsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listDescendants, pq.Array(arg.ParentIds), arg.MaxDepth, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RepostOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReplies = `-- name: ListReplies :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, deleted_at, like_count, repost_of FROM chirps
+WHERE parent_id = $1
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListRepliesParams struct {
+	ParentID        uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListReplies(ctx context.Context, arg ListRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listReplies,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RepostOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+WITH revisions AS (
+    DELETE FROM chirp_revisions
+    WHERE chirp_id = $1
+), mentions AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id = $1
+), hashtags AS (
+    DELETE FROM chirp_hashtags
+    WHERE chirp_id = $1
+), media AS (
+    DELETE FROM media_attachments
+    WHERE chirp_id = $1
+), rechirps AS (
+    DELETE FROM chirps
+    WHERE repost_of = $1 AND body = '' AND deleted_at IS NULL
+)
+UPDATE chirps
+SET body = '', updated_at = NOW(), deleted_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
@@ -0,0 +1,106 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Mention is an @handle found in a chirp body. Start and End are offsets in
+// Unicode code points, not bytes, with Start on the @ and End exclusive.
+type Mention struct {
+    Handle string
+    Start int
+    End int
+}
+
+const (
+    minHandleLength = 3
+    maxHandleLength = 30
+)
+
+// ExtractMentions returns every @handle in text in order of appearance. An @
+// directly after a handle character, as in an email address, does not start
+// a mention, and runs longer than a handle can be are ignored.
+func ExtractMentions(text string) []Mention {
+    mentions := []Mention{}
+    runes := []rune(text)
+
+    for i := 0; i < len(runes); i++ {
+        if runes[i] != '@' || (i > 0 && isHandleRune(runes[i-1])) {
+            continue
+        }
+
+        end := i + 1
+        for end < len(runes) && isHandleRune(runes[end]) {
+            end++
+        }
+
+        length := end - i - 1
+        if length >= minHandleLength && length <= maxHandleLength {
+            mentions = append(mentions, Mention{
+                Handle: string(runes[i+1:end]),
+                Start: i,
+                End: end,
+            })
+        }
+        i = end - 1
+    }
+
+    return mentions
+}
+
+func isHandleRune(r rune) bool {
+    return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+// Hashtag is a #tag found in a chirp body, with offsets counted like
+// Mention's. Tag is normalized and does not include the #.
+type Hashtag struct {
+    Tag string
+    Start int
+    End int
+}
+
+const maxHashtagLength = 50
+
+// ExtractHashtags returns every #tag in text in order of appearance. Tags are
+// letters, digits and underscores, need at least one letter and are
+// lowercased so #Go and #go are the same tag.
+func ExtractHashtags(text string) []Hashtag {
+    hashtags := []Hashtag{}
+    runes := []rune(text)
+
+    for i := 0; i < len(runes); i++ {
+        if runes[i] != '#' || (i > 0 && isHashtagRune(runes[i-1])) {
+            continue
+        }
+
+        end := i + 1
+        hasLetter := false
+        for end < len(runes) && isHashtagRune(runes[end]) {
+            hasLetter = hasLetter || unicode.IsLetter(runes[end])
+            end++
+        }
+
+        length := end - i - 1
+        if hasLetter && length <= maxHashtagLength {
+            hashtags = append(hashtags, Hashtag{
+                Tag: NormalizeHashtag(string(runes[i+1:end])),
+                Start: i,
+                End: end,
+            })
+        }
+        i = end - 1
+    }
+
+    return hashtags
+}
+
+// NormalizeHashtag turns user input such as "#Golang" into the stored form.
+func NormalizeHashtag(tag string) string {
+    return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func isHashtagRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
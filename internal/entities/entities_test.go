@@ -0,0 +1,64 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+    cases := []struct {
+        in string
+        want []Mention
+    }{
+        {"hello world", []Mention{}},
+        {"@alice hi", []Mention{{Handle: "alice", Start: 0, End: 6}}},
+        {"hi @bob_1, and @carol!", []Mention{
+            {Handle: "bob_1", Start: 3, End: 9},
+            {Handle: "carol", Start: 15, End: 21},
+        }},
+        {"mail me at dan@example.com", []Mention{}},
+        {"@ab is too short", []Mention{}},
+        {"@abcdefghijklmnopqrstuvwxyz12345 is too long", []Mention{}},
+        {"(@@eve)", []Mention{{Handle: "eve", Start: 2, End: 6}}},
+        {"héllo @zoë", []Mention{}},
+        {"héllo @zoe", []Mention{{Handle: "zoe", Start: 6, End: 10}}},
+    }
+
+    for _, c := range cases {
+        got := ExtractMentions(c.in)
+        if !reflect.DeepEqual(got, c.want) {
+            t.Errorf("ExtractMentions(%q) = %+v, want %+v", c.in, got, c.want)
+        }
+    }
+}
+
+func TestExtractHashtags(t *testing.T) {
+    cases := []struct {
+        in string
+        want []Hashtag
+    }{
+        {"no tags here", []Hashtag{}},
+        {"#Go is fun", []Hashtag{{Tag: "go", Start: 0, End: 3}}},
+        {"loving #golang, #Go_1 and #123", []Hashtag{
+            {Tag: "golang", Start: 7, End: 14},
+            {Tag: "go_1", Start: 16, End: 21},
+        }},
+        {"issue#42 and a#b", []Hashtag{}},
+        {"café #crème", []Hashtag{{Tag: "crème", Start: 5, End: 11}}},
+    }
+
+    for _, c := range cases {
+        got := ExtractHashtags(c.in)
+        if !reflect.DeepEqual(got, c.want) {
+            t.Errorf("ExtractHashtags(%q) = %+v, want %+v", c.in, got, c.want)
+        }
+    }
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+    for _, in := range []string{"#GoLang", "golang", " #golang "} {
+        if got := NormalizeHashtag(in); got != "golang" {
+            t.Errorf("NormalizeHashtag(%q) = %q, want golang", in, got)
+        }
+    }
+}
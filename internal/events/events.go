@@ -0,0 +1,206 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+    ChirpCreated = "chirp.created"
+    ChirpDeleted = "chirp.deleted"
+    UserUpgraded = "user.upgraded"
+    TokenRevoked = "token.revoked"
+
+    DefaultChannel = "chirpy_events"
+    // Postgres refuses NOTIFY payloads of 8000 bytes or more.
+    maxNotifyPayload = 7999
+)
+
+var ErrPayloadTooLarge = errors.New("Event payload is too large")
+
+// Event is something that happened on one instance that the others may need
+// to know about. Payload is the JSON the publisher chose for Type, and ID
+// names what the event is about, such as the chirp for chirp events.
+type Event struct {
+    Type string `json:"type"`
+    ID uuid.UUID `json:"id"`
+    Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type Handler func(Event)
+
+// Resolver rebuilds the payload of an event that arrived by reference, with
+// only its type and ID, because it was too large to send whole.
+type Resolver func(ctx context.Context, eventType string, id uuid.UUID) (json.RawMessage, error)
+
+// Bus delivers every published event to every subscribed handler, on every
+// instance sharing the bus. Handlers may be called concurrently and must not
+// block for long. Implementations must be safe for concurrent use.
+type Bus interface {
+    Publish(ctx context.Context, event Event) error
+    Subscribe(handler Handler)
+}
+
+// LocalBus delivers events within this process only, for single-instance
+// deployments and tests.
+type LocalBus struct {
+    mu sync.Mutex
+    handlers []Handler
+}
+
+func (b *LocalBus) Publish(ctx context.Context, event Event) error {
+    b.mu.Lock()
+    handlers := b.handlers
+    b.mu.Unlock()
+
+    for _, handler := range handlers {
+        handler(event)
+    }
+
+    return nil
+}
+
+func (b *LocalBus) Subscribe(handler Handler) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.handlers = append(b.handlers, handler)
+}
+
+// envelope is what goes over NOTIFY. Origin lets an instance skip its own
+// events, which it has already delivered locally.
+type envelope struct {
+    Origin uuid.UUID `json:"origin"`
+    Event
+}
+
+// PostgresBus shares events between instances with LISTEN/NOTIFY. Events
+// are delivered locally straight away and to other instances through
+// Postgres. An event too large for NOTIFY is sent by reference and rebuilt
+// by the receiving instance's Resolver. Notifications sent while an
+// instance's listener is reconnecting are lost to it, so consumers must treat
+// the bus as best effort.
+type PostgresBus struct {
+    db *sql.DB
+    channel string
+    origin uuid.UUID
+    listener *pq.Listener
+    resolve Resolver
+    local LocalBus
+}
+
+// NewPostgresBus starts listening on channel over a dedicated connection to
+// connStr and sends notifications through db. resolve rebuilds events other
+// instances sent by reference.
+func NewPostgresBus(db *sql.DB, connStr, channel string, resolve Resolver) (*PostgresBus, error) {
+    listener := pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+        if err != nil {
+            log.Printf("Event bus listener: %v", err)
+        }
+    })
+
+    err := listener.Listen(channel)
+    if err != nil {
+        listener.Close()
+        return nil, err
+    }
+
+    bus := &PostgresBus{
+        db: db,
+        channel: channel,
+        origin: uuid.New(),
+        listener: listener,
+        resolve: resolve,
+    }
+    go bus.run()
+
+    return bus, nil
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, event Event) error {
+    b.local.Publish(ctx, event)
+
+    data, err := b.notifyPayload(event)
+    if err != nil {
+        return err
+    }
+
+    _, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, data)
+    return err
+}
+
+// notifyPayload encodes event for NOTIFY, leaving the payload out when the
+// whole event would not fit.
+func (b *PostgresBus) notifyPayload(event Event) (string, error) {
+    data, err := json.Marshal(envelope{Origin: b.origin, Event: event})
+    if err != nil {
+        return "", err
+    }
+    if len(data) <= maxNotifyPayload {
+        return string(data), nil
+    }
+    if event.ID == uuid.Nil {
+        return "", ErrPayloadTooLarge
+    }
+
+    data, err = json.Marshal(envelope{Origin: b.origin, Event: Event{Type: event.Type, ID: event.ID}})
+    if err != nil {
+        return "", err
+    }
+
+    return string(data), nil
+}
+
+func (b *PostgresBus) Subscribe(handler Handler) {
+    b.local.Subscribe(handler)
+}
+
+func (b *PostgresBus) Close() error {
+    return b.listener.Close()
+}
+
+func (b *PostgresBus) run() {
+    for notification := range b.listener.Notify {
+        // A nil notification means the connection was re-established and
+        // anything sent in between was missed.
+        if notification == nil {
+            log.Printf("Event bus listener reconnected, events may have been missed")
+            continue
+        }
+        b.deliver(notification.Extra)
+    }
+}
+
+func (b *PostgresBus) deliver(payload string) {
+    var received envelope
+    err := json.Unmarshal([]byte(payload), &received)
+    if err != nil {
+        log.Printf("Failed to decode event: %v", err)
+        return
+    }
+    if received.Origin == b.origin {
+        return
+    }
+
+    if len(received.Payload) == 0 {
+        if b.resolve == nil {
+            log.Printf("No resolver for %s event %v sent by reference", received.Type, received.ID)
+            return
+        }
+        received.Payload, err = b.resolve(context.Background(), received.Type, received.ID)
+        if err != nil {
+            log.Printf("Failed to resolve %s event %v: %v", received.Type, received.ID, err)
+            return
+        }
+    }
+
+    b.local.Publish(context.Background(), received.Event)
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalBus(t *testing.T) {
+    bus := &LocalBus{}
+    var first, second []Event
+    bus.Subscribe(func(event Event) { first = append(first, event) })
+    bus.Subscribe(func(event Event) { second = append(second, event) })
+
+    event := Event{Type: ChirpCreated, Payload: json.RawMessage(`{"id":"1"}`)}
+    err := bus.Publish(context.Background(), event)
+    if err != nil {
+        t.Fatalf("Failed to publish: %v", err)
+    }
+
+    if len(first) != 1 || len(second) != 1 || first[0].Type != ChirpCreated || string(second[0].Payload) != `{"id":"1"}` {
+        t.Errorf("Unexpected deliveries %+v, %+v", first, second)
+    }
+}
+
+func TestPostgresBusDeliver(t *testing.T) {
+    bus := &PostgresBus{origin: uuid.New()}
+    received := []Event{}
+    bus.Subscribe(func(event Event) { received = append(received, event) })
+
+    encode := func(origin uuid.UUID, eventType string) string {
+        data, _ := json.Marshal(envelope{Origin: origin, Event: Event{Type: eventType, Payload: json.RawMessage(`{}`)}})
+        return string(data)
+    }
+
+    bus.deliver(encode(bus.origin, ChirpCreated))
+    bus.deliver(encode(uuid.New(), UserUpgraded))
+    bus.deliver("not json")
+
+    if len(received) != 1 || received[0].Type != UserUpgraded {
+        t.Errorf("Expected only the other instance's event, got %+v", received)
+    }
+}
+
+func TestPostgresBusOversizedEvent(t *testing.T) {
+    bus := &PostgresBus{origin: uuid.New()}
+    payload, _ := json.Marshal(strings.Repeat("x", maxNotifyPayload))
+    event := Event{Type: ChirpCreated, ID: uuid.New(), Payload: payload}
+
+    data, err := bus.notifyPayload(event)
+    if err != nil {
+        t.Fatalf("Failed to encode oversized event: %v", err)
+    }
+    if len(data) > maxNotifyPayload || strings.Contains(data, `"payload"`) {
+        t.Fatalf("Expected the event by reference, got %d bytes", len(data))
+    }
+
+    _, err = bus.notifyPayload(Event{Type: ChirpCreated, Payload: payload})
+    if err != ErrPayloadTooLarge {
+        t.Errorf("Expected ErrPayloadTooLarge without an ID, got %v", err)
+    }
+
+    receiver := &PostgresBus{origin: uuid.New()}
+    receiver.resolve = func(ctx context.Context, eventType string, id uuid.UUID) (json.RawMessage, error) {
+        if eventType != ChirpCreated || id != event.ID {
+            t.Errorf("Unexpected reference %s %v", eventType, id)
+        }
+        return json.RawMessage(`{"rebuilt":true}`), nil
+    }
+    received := []Event{}
+    receiver.Subscribe(func(event Event) { received = append(received, event) })
+
+    receiver.deliver(data)
+    if len(received) != 1 || string(received[0].Payload) != `{"rebuilt":true}` {
+        t.Errorf("Expected the resolved event, got %+v", received)
+    }
+}
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+    To string
+    Subject string
+    Body string
+}
+
+// Mailer delivers outgoing email. Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+// Format renders msg as a plain-text RFC 5322 message.
+func Format(from string, msg Message) []byte {
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", from)
+    fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+    fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+    fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+    b.WriteString("\r\n")
+    b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+    return []byte(b.String())
+}
+
+type SMTPMailer struct {
+    Addr string
+    From string
+    Auth smtp.Auth
+}
+
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+    var auth smtp.Auth
+    if username != "" {
+        host, _, _ := strings.Cut(addr, ":")
+        auth = smtp.PlainAuth("", username, password, host)
+    }
+
+    return &SMTPMailer{
+        Addr: addr,
+        From: from,
+        Auth: auth,
+    }
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+    return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, Format(m.From, msg))
+}
+
+// FileMailer writes each message to its own .eml file in Dir, for local
+// development and tests.
+type FileMailer struct {
+    Dir string
+    From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+    err := os.MkdirAll(m.Dir, 0755)
+    if err != nil {
+        return err
+    }
+
+    name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New())
+    return os.WriteFile(filepath.Join(m.Dir, name), Format(m.From, msg), 0644)
+}
+
+// LogMailer prints messages instead of sending them.
+type LogMailer struct {
+    Out io.Writer
+    From string
+
+    mu sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    _, err := fmt.Fprintf(m.Out, "----- mail -----\n%s\n----------------\n", Format(m.From, msg))
+    return err
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+    dir := t.TempDir()
+    mailer := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+    err := mailer.Send(context.Background(), Message{
+        To: "user@example.com",
+        Subject: "Hello",
+        Body: "line one\nline two",
+    })
+    if err != nil {
+        t.Fatalf("Failed to send mail: %v", err)
+    }
+
+    files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+    if err != nil || len(files) != 1 {
+        t.Fatalf("Expected one mail file, got %v (%v)", files, err)
+    }
+
+    data, err := os.ReadFile(files[0])
+    if err != nil {
+        t.Fatalf("Failed to read mail: %v", err)
+    }
+    for _, want := range []string{"From: chirpy@example.com\r\n", "To: user@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two"} {
+        if !strings.Contains(string(data), want) {
+            t.Errorf("Mail is missing %q:\n%s", want, data)
+        }
+    }
+}
+
+func TestLogMailer(t *testing.T) {
+    var out bytes.Buffer
+    mailer := &LogMailer{Out: &out, From: "chirpy@example.com"}
+
+    err := mailer.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "token"})
+    if err != nil {
+        t.Fatalf("Failed to send mail: %v", err)
+    }
+    if !strings.Contains(out.String(), "Subject: Hi") {
+        t.Errorf("Unexpected log output: %s", out.String())
+    }
+}
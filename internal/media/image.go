@@ -0,0 +1,355 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+    // MaxPixels bounds decoded size so a small file cannot expand into
+    // gigabytes of pixels. A JPEG at the limit still needs about 100 MB
+    // while it is decoded and re-oriented.
+    MaxPixels = 16_000_000
+    ThumbnailSize = 400
+    jpegQuality = 90
+)
+
+var (
+    ErrUnsupportedType = errors.New("Unsupported media type")
+    ErrTooManyPixels = errors.New("Image dimensions are too large")
+)
+
+// Image is an upload after processing: re-encoded without metadata and
+// with a thumbnail no larger than ThumbnailSize on either side.
+type Image struct {
+    ContentType string
+    Ext string
+    Data []byte
+    Width int
+    Height int
+    Thumbnail []byte
+    ThumbnailContentType string
+    ThumbnailExt string
+}
+
+// ProcessImage sniffs data rather than trusting the client's content type,
+// then decodes and re-encodes it. Re-encoding drops EXIF, text chunks and
+// anything else riding along in the file; JPEG orientation is applied to
+// the pixels first so photos still display upright.
+func ProcessImage(data []byte) (*Image, error) {
+    contentType := http.DetectContentType(data)
+    switch contentType {
+    case "image/jpeg", "image/png", "image/gif":
+    default:
+        return nil, ErrUnsupportedType
+    }
+
+    config, _, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    if config.Width * config.Height > MaxPixels {
+        return nil, ErrTooManyPixels
+    }
+
+    var out bytes.Buffer
+    var first image.Image
+    processed := &Image{
+        ContentType: contentType,
+    }
+
+    switch contentType {
+    case "image/jpeg":
+        img, err := jpeg.Decode(bytes.NewReader(data))
+        if err != nil {
+            return nil, err
+        }
+        first = orient(img, jpegOrientation(data))
+        err = jpeg.Encode(&out, first, &jpeg.Options{Quality: jpegQuality})
+        if err != nil {
+            return nil, err
+        }
+        processed.Ext = ".jpg"
+    case "image/png":
+        img, err := png.Decode(bytes.NewReader(data))
+        if err != nil {
+            return nil, err
+        }
+        first = img
+        err = png.Encode(&out, img)
+        if err != nil {
+            return nil, err
+        }
+        processed.Ext = ".png"
+    case "image/gif":
+        // Every frame counts against the pixel budget, and the budget is
+        // checked before anything is decompressed.
+        err := checkGIFPixels(data)
+        if err != nil {
+            return nil, err
+        }
+        anim, err := gif.DecodeAll(bytes.NewReader(data))
+        if err != nil {
+            return nil, err
+        }
+        first = anim.Image[0]
+        err = gif.EncodeAll(&out, anim)
+        if err != nil {
+            return nil, err
+        }
+        processed.Ext = ".gif"
+    }
+
+    processed.Data = out.Bytes()
+    processed.Width = first.Bounds().Dx()
+    processed.Height = first.Bounds().Dy()
+
+    // JPEG thumbnails stay JPEG; the rest become PNG to keep transparency.
+    var thumb bytes.Buffer
+    if contentType == "image/jpeg" {
+        err = jpeg.Encode(&thumb, thumbnail(first, ThumbnailSize), &jpeg.Options{Quality: jpegQuality})
+        processed.ThumbnailContentType = "image/jpeg"
+        processed.ThumbnailExt = ".jpg"
+    } else {
+        err = png.Encode(&thumb, thumbnail(first, ThumbnailSize))
+        processed.ThumbnailContentType = "image/png"
+        processed.ThumbnailExt = ".png"
+    }
+    if err != nil {
+        return nil, err
+    }
+    processed.Thumbnail = thumb.Bytes()
+
+    return processed, nil
+}
+
+var errMalformedGIF = errors.New("Malformed GIF")
+
+// checkGIFPixels walks the blocks of a GIF without decoding any image data
+// and fails with ErrTooManyPixels as soon as the frames declared so far add
+// up to more than MaxPixels.
+func checkGIFPixels(data []byte) error {
+    if len(data) < 13 {
+        return errMalformedGIF
+    }
+    pos := 13
+    if data[10] & 0x80 != 0 {
+        pos += 3 << ((data[10] & 0x07) + 1)
+    }
+
+    // skipSubBlocks returns the offset just past a run of data sub-blocks,
+    // which ends with a zero-length block.
+    skipSubBlocks := func(pos int) (int, error) {
+        for {
+            if pos >= len(data) {
+                return 0, errMalformedGIF
+            }
+            size := int(data[pos])
+            pos++
+            if size == 0 {
+                return pos, nil
+            }
+            pos += size
+        }
+    }
+
+    total := 0
+    for {
+        if pos >= len(data) {
+            return errMalformedGIF
+        }
+        var err error
+        switch data[pos] {
+        case 0x21:
+            pos, err = skipSubBlocks(pos + 2)
+            if err != nil {
+                return err
+            }
+        case 0x2c:
+            if pos + 10 > len(data) {
+                return errMalformedGIF
+            }
+            width := int(binary.LittleEndian.Uint16(data[pos+5:]))
+            height := int(binary.LittleEndian.Uint16(data[pos+7:]))
+            total += width * height
+            if total > MaxPixels {
+                return ErrTooManyPixels
+            }
+            packed := data[pos+9]
+            pos += 10
+            if packed & 0x80 != 0 {
+                pos += 3 << ((packed & 0x07) + 1)
+            }
+            // Skip the LZW minimum code size, then the image data.
+            pos, err = skipSubBlocks(pos + 1)
+            if err != nil {
+                return err
+            }
+        case 0x3b:
+            return nil
+        default:
+            return errMalformedGIF
+        }
+    }
+}
+
+// thumbnail scales img to fit in a size by size box, averaging the source
+// pixels under each output pixel. Pixels are read straight from img, so only
+// the thumbnail itself is allocated.
+func thumbnail(img image.Image, size int) *image.RGBA {
+    bounds := img.Bounds()
+    srcW, srcH := bounds.Dx(), bounds.Dy()
+
+    dstW, dstH := srcW, srcH
+    if srcW > size || srcH > size {
+        if srcW >= srcH {
+            dstW, dstH = size, max(1, srcH * size / srcW)
+        } else {
+            dstW, dstH = max(1, srcW * size / srcH), size
+        }
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+    for y := 0; y < dstH; y++ {
+        y0, y1 := y * srcH / dstH, max((y + 1) * srcH / dstH, y * srcH / dstH + 1)
+        for x := 0; x < dstW; x++ {
+            x0, x1 := x * srcW / dstW, max((x + 1) * srcW / dstW, x * srcW / dstW + 1)
+
+            var r, g, b, a, n uint32
+            for sy := y0; sy < y1; sy++ {
+                for sx := x0; sx < x1; sx++ {
+                    cr, cg, cb, ca := img.At(bounds.Min.X + sx, bounds.Min.Y + sy).RGBA()
+                    r += cr >> 8
+                    g += cg >> 8
+                    b += cb >> 8
+                    a += ca >> 8
+                    n++
+                }
+            }
+            dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)})
+        }
+    }
+
+    return dst
+}
+
+// jpegOrientation returns the EXIF orientation (1 to 8) of a JPEG, or 1 when
+// there is none.
+func jpegOrientation(data []byte) int {
+    if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+        return 1
+    }
+
+    for pos := 2; pos + 4 <= len(data); {
+        if data[pos] != 0xff {
+            return 1
+        }
+        marker := data[pos+1]
+        // Start of scan: no more metadata segments follow.
+        if marker == 0xda {
+            return 1
+        }
+        length := int(binary.BigEndian.Uint16(data[pos+2:]))
+        end := pos + 2 + length
+        if length < 2 || end > len(data) {
+            return 1
+        }
+
+        segment := data[pos+4:end]
+        if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+            return exifOrientation(segment[6:])
+        }
+        pos = end
+    }
+
+    return 1
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of a TIFF header.
+func exifOrientation(tiff []byte) int {
+    if len(tiff) < 8 {
+        return 1
+    }
+
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 1
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd < 8 || ifd + 2 > len(tiff) {
+        return 1
+    }
+
+    count := int(order.Uint16(tiff[ifd:]))
+    for i := 0; i < count; i++ {
+        entry := ifd + 2 + i * 12
+        if entry + 12 > len(tiff) {
+            return 1
+        }
+        if order.Uint16(tiff[entry:]) == 0x0112 {
+            orientation := int(order.Uint16(tiff[entry+8:]))
+            if orientation < 1 || orientation > 8 {
+                return 1
+            }
+            return orientation
+        }
+    }
+
+    return 1
+}
+
+// orient applies an EXIF orientation so the result displays correctly
+// without it. Orientations 5 to 8 swap width and height.
+func orient(img image.Image, orientation int) image.Image {
+    if orientation == 1 {
+        return img
+    }
+
+    bounds := img.Bounds()
+    w, h := bounds.Dx(), bounds.Dy()
+    dstW, dstH := w, h
+    if orientation >= 5 {
+        dstW, dstH = h, w
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+    for y := 0; y < dstH; y++ {
+        for x := 0; x < dstW; x++ {
+            var sx, sy int
+            switch orientation {
+            case 2:
+                sx, sy = w - 1 - x, y
+            case 3:
+                sx, sy = w - 1 - x, h - 1 - y
+            case 4:
+                sx, sy = x, h - 1 - y
+            case 5:
+                sx, sy = y, x
+            case 6:
+                sx, sy = y, h - 1 - x
+            case 7:
+                sx, sy = w - 1 - y, h - 1 - x
+            case 8:
+                sx, sy = w - 1 - y, x
+            default:
+                sx, sy = x, y
+            }
+            dst.Set(x, y, img.At(bounds.Min.X + sx, bounds.Min.Y + sy))
+        }
+    }
+
+    return dst
+}
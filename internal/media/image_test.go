@@ -0,0 +1,182 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// withOrientation splices an EXIF segment carrying orientation into a JPEG
+// right after its SOI marker.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+    tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+    tiff = binary.BigEndian.AppendUint16(tiff, 1)
+    tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+    tiff = binary.BigEndian.AppendUint16(tiff, 3)
+    tiff = binary.BigEndian.AppendUint32(tiff, 1)
+    tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+    tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+    payload := append([]byte("Exif\x00\x00"), tiff...)
+    segment := []byte{0xff, 0xe1}
+    segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload) + 2))
+    segment = append(segment, payload...)
+
+    out := append([]byte{}, jpg[:2]...)
+    out = append(out, segment...)
+    return append(out, jpg[2:]...)
+}
+
+func TestProcessImageJPEG(t *testing.T) {
+    img := image.NewRGBA(image.Rect(0, 0, 800, 200))
+    var buf bytes.Buffer
+    err := jpeg.Encode(&buf, img, nil)
+    if err != nil {
+        t.Fatalf("Failed to encode JPEG: %v", err)
+    }
+    data := withOrientation(buf.Bytes(), 6)
+    if jpegOrientation(data) != 6 {
+        t.Fatalf("Expected orientation 6, got %d", jpegOrientation(data))
+    }
+
+    processed, err := ProcessImage(data)
+    if err != nil {
+        t.Fatalf("Failed to process image: %v", err)
+    }
+    if processed.ContentType != "image/jpeg" || processed.Ext != ".jpg" {
+        t.Errorf("Unexpected type %s %s", processed.ContentType, processed.Ext)
+    }
+    if processed.Width != 200 || processed.Height != 800 {
+        t.Errorf("Expected the image rotated to 200x800, got %dx%d", processed.Width, processed.Height)
+    }
+    if bytes.Contains(processed.Data, []byte("Exif")) {
+        t.Errorf("EXIF data was not stripped")
+    }
+
+    thumb, err := jpeg.DecodeConfig(bytes.NewReader(processed.Thumbnail))
+    if err != nil {
+        t.Fatalf("Failed to decode thumbnail: %v", err)
+    }
+    if thumb.Width != 100 || thumb.Height != ThumbnailSize {
+        t.Errorf("Expected a 100x%d thumbnail, got %dx%d", ThumbnailSize, thumb.Width, thumb.Height)
+    }
+}
+
+func TestProcessImagePNGAndGIF(t *testing.T) {
+    img := image.NewNRGBA(image.Rect(0, 0, 10, 20))
+    img.Set(0, 0, color.NRGBA{255, 0, 0, 128})
+    var pngBuf bytes.Buffer
+    png.Encode(&pngBuf, img)
+
+    processed, err := ProcessImage(pngBuf.Bytes())
+    if err != nil {
+        t.Fatalf("Failed to process PNG: %v", err)
+    }
+    if processed.ContentType != "image/png" || processed.Width != 10 || processed.Height != 20 {
+        t.Errorf("Unexpected PNG result %s %dx%d", processed.ContentType, processed.Width, processed.Height)
+    }
+
+    palette := color.Palette{color.Black, color.White}
+    anim := &gif.GIF{
+        Image: []*image.Paletted{
+            image.NewPaletted(image.Rect(0, 0, 4, 4), palette),
+            image.NewPaletted(image.Rect(0, 0, 4, 4), palette),
+        },
+        Delay: []int{10, 10},
+    }
+    var gifBuf bytes.Buffer
+    gif.EncodeAll(&gifBuf, anim)
+
+    processed, err = ProcessImage(gifBuf.Bytes())
+    if err != nil {
+        t.Fatalf("Failed to process GIF: %v", err)
+    }
+    decoded, err := gif.DecodeAll(bytes.NewReader(processed.Data))
+    if err != nil || len(decoded.Image) != 2 {
+        t.Errorf("Expected the animation to survive, got %v", err)
+    }
+    if processed.ThumbnailContentType != "image/png" {
+        t.Errorf("Expected a PNG thumbnail, got %s", processed.ThumbnailContentType)
+    }
+}
+
+// framedGIF builds a GIF whose frames each declare width x height pixels but
+// carry only a token amount of image data, like a highly compressed bomb.
+func framedGIF(frames, width, height int) []byte {
+    out := []byte("GIF89a")
+    out = binary.LittleEndian.AppendUint16(out, uint16(width))
+    out = binary.LittleEndian.AppendUint16(out, uint16(height))
+    out = append(out, 0x80, 0, 0)
+    out = append(out, 0, 0, 0, 255, 255, 255)
+
+    for i := 0; i < frames; i++ {
+        out = append(out, 0x21, 0xf9, 4, 0, 10, 0, 0, 0)
+        out = append(out, 0x2c, 0, 0, 0, 0)
+        out = binary.LittleEndian.AppendUint16(out, uint16(width))
+        out = binary.LittleEndian.AppendUint16(out, uint16(height))
+        out = append(out, 0)
+        out = append(out, 2, 2, 0x4c, 0x01, 0)
+    }
+
+    return append(out, 0x3b)
+}
+
+func TestProcessImageRejectsManyFrameGIF(t *testing.T) {
+    // Each frame fits the budget on its own; together they do not.
+    _, err := ProcessImage(framedGIF(2, 3000, 3000))
+    if !errors.Is(err, ErrTooManyPixels) {
+        t.Errorf("Expected ErrTooManyPixels for two large frames, got %v", err)
+    }
+
+    _, err = ProcessImage(framedGIF(500, 300, 300))
+    if !errors.Is(err, ErrTooManyPixels) {
+        t.Errorf("Expected ErrTooManyPixels for many small frames, got %v", err)
+    }
+
+    err = checkGIFPixels(framedGIF(3, 100, 100))
+    if err != nil {
+        t.Errorf("Expected a small animation to pass, got %v", err)
+    }
+}
+
+func TestProcessImageRejects(t *testing.T) {
+    _, err := ProcessImage([]byte("<html><script>alert(1)</script></html>"))
+    if !errors.Is(err, ErrUnsupportedType) {
+        t.Errorf("Expected ErrUnsupportedType, got %v", err)
+    }
+
+    // A PNG header claiming 100000x100000 pixels with no image data.
+    var buf bytes.Buffer
+    png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+    data := buf.Bytes()
+    binary.BigEndian.PutUint32(data[16:], 100000)
+    binary.BigEndian.PutUint32(data[20:], 100000)
+    binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+    _, err = ProcessImage(data)
+    if !errors.Is(err, ErrTooManyPixels) {
+        t.Errorf("Expected ErrTooManyPixels, got %v", err)
+    }
+}
+
+func TestOrient(t *testing.T) {
+    img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+    img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+    // Orientation 6 means the camera was turned clockwise, so the left
+    // pixel ends up on top.
+    rotated := orient(img, 6)
+    if rotated.Bounds().Dx() != 1 || rotated.Bounds().Dy() != 2 {
+        t.Fatalf("Unexpected bounds %v", rotated.Bounds())
+    }
+    r, _, _, _ := rotated.At(0, 0).RGBA()
+    if r == 0 {
+        t.Errorf("Expected the red pixel at the top")
+    }
+}
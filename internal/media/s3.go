@@ -0,0 +1,187 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const amzDateLayout = "20060102T150405Z"
+
+// S3Store keeps blobs in a bucket of any S3-compatible service, addressed
+// path-style as Endpoint/Bucket/key so it also works against MinIO and
+// local stand-ins. Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+    Endpoint string
+    Bucket string
+    Region string
+    AccessKeyID string
+    SecretAccessKey string
+    Client *http.Client
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+    if !validKey(key) {
+        return ErrInvalidKey
+    }
+
+    req, err := s.newRequest(ctx, http.MethodPut, key, data)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", contentType)
+
+    resp, err := s.do(req, data)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    return checkStatus(resp)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (*Object, error) {
+    if !validKey(key) {
+        return nil, ErrNotFound
+    }
+
+    req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := s.do(req, nil)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode == http.StatusNotFound {
+        resp.Body.Close()
+        return nil, ErrNotFound
+    }
+    err = checkStatus(resp)
+    if err != nil {
+        resp.Body.Close()
+        return nil, err
+    }
+
+    return &Object{
+        Body: resp.Body,
+        ContentType: resp.Header.Get("Content-Type"),
+        Size: resp.ContentLength,
+    }, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+    if !validKey(key) {
+        return ErrInvalidKey
+    }
+
+    req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+    if err != nil {
+        return err
+    }
+
+    resp, err := s.do(req, nil)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    // S3 answers 204 whether or not the key existed.
+    if resp.StatusCode == http.StatusNotFound {
+        return nil
+    }
+    return checkStatus(resp)
+}
+
+func (s *S3Store) newRequest(ctx context.Context, method, key string, data []byte) (*http.Request, error) {
+    url := strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + key
+    return http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+}
+
+func (s *S3Store) do(req *http.Request, data []byte) (*http.Response, error) {
+    sum := sha256.Sum256(data)
+    signV4(req, hex.EncodeToString(sum[:]), s.Region, s.AccessKeyID, s.SecretAccessKey, time.Now())
+
+    client := s.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+
+    return client.Do(req)
+}
+
+func checkStatus(resp *http.Response) error {
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return nil
+    }
+
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    return fmt.Errorf("S3 request failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// signV4 adds the x-amz-date, x-amz-content-sha256 and Authorization
+// headers. Every header already set on req is signed along with Host.
+func signV4(req *http.Request, payloadHash, region, accessKeyID, secretAccessKey string, now time.Time) {
+    now = now.UTC()
+    amzDate := now.Format(amzDateLayout)
+    date := now.Format("20060102")
+
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    headers := map[string]string{"host": req.URL.Host}
+    for name, values := range req.Header {
+        headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+    }
+
+    names := []string{}
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        req.URL.Query().Encode(),
+        canonicalHeaders.String(),
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    scope := date + "/" + region + "/s3/aws4_request"
+    requestHash := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+    key := hmacSHA256([]byte("AWS4" + secretAccessKey), date)
+    key = hmacSHA256(key, region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf(
+        "AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        accessKeyID, scope, signedHeaders, signature,
+    ))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
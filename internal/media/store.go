@@ -0,0 +1,120 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+    ErrNotFound = errors.New("Blob not found")
+    ErrInvalidKey = errors.New("Invalid blob key")
+)
+
+// Keys are flat names like <uuid>.jpg. Refusing anything else keeps them
+// safe to use as file names and URL path segments in every store.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validKey(key string) bool {
+    return len(key) <= 200 && keyPattern.MatchString(key)
+}
+
+// Object is a stored blob opened for reading. Callers must close Body.
+type Object struct {
+    Body io.ReadCloser
+    ContentType string
+    Size int64
+}
+
+// BlobStore keeps uploaded media. Blobs are written once and never changed,
+// so callers may cache them forever. Implementations must be safe for
+// concurrent use.
+type BlobStore interface {
+    Put(ctx context.Context, key string, data []byte, contentType string) error
+    Get(ctx context.Context, key string) (*Object, error)
+    Delete(ctx context.Context, key string) error
+}
+
+// LocalStore keeps blobs as files in Dir. The content type is taken from
+// the key's extension.
+type LocalStore struct {
+    Dir string
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+    if !validKey(key) {
+        return ErrInvalidKey
+    }
+
+    err := os.MkdirAll(s.Dir, 0755)
+    if err != nil {
+        return err
+    }
+
+    // Write then rename so readers never see a partial file.
+    tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    _, err = tmp.Write(data)
+    if err != nil {
+        tmp.Close()
+        return err
+    }
+    err = tmp.Close()
+    if err != nil {
+        return err
+    }
+
+    return os.Rename(tmp.Name(), filepath.Join(s.Dir, key))
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (*Object, error) {
+    if !validKey(key) {
+        return nil, ErrNotFound
+    }
+
+    file, err := os.Open(filepath.Join(s.Dir, key))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    contentType := mime.TypeByExtension(filepath.Ext(key))
+    if contentType == "" {
+        contentType = "application/octet-stream"
+    }
+
+    return &Object{
+        Body: file,
+        ContentType: contentType,
+        Size: info.Size(),
+    }, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+    if !validKey(key) {
+        return ErrInvalidKey
+    }
+
+    err := os.Remove(filepath.Join(s.Dir, key))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+
+    return err
+}
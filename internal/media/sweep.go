@@ -0,0 +1,64 @@
+package media
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/zulkou/chirpy/internal/database"
+)
+
+// Sweeper deletes uploads that were not attached to a chirp within MaxAge,
+// blobs included, so abandoned uploads don't pile up in storage. A chirp
+// racing the sweep fails to attach the media rather than losing it silently.
+type Sweeper struct {
+    DB *database.Queries
+    Blobs BlobStore
+    MaxAge time.Duration
+    Interval time.Duration
+}
+
+var (
+    DefaultUnattachedMaxAge = 24 * time.Hour
+    DefaultSweepInterval = 1 * time.Hour
+)
+
+// Run sweeps straight away and then every Interval until ctx is done.
+// Failures are logged and retried on the next tick.
+func (s *Sweeper) Run(ctx context.Context) {
+    ticker := time.NewTicker(s.Interval)
+    defer ticker.Stop()
+
+    for {
+        err := s.Sweep(ctx)
+        if err != nil {
+            log.Printf("Failed to sweep unattached media: %v", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Sweep removes the rows first so nothing can attach them afterwards, then
+// deletes their blobs. A blob that fails to delete is only logged.
+func (s *Sweeper) Sweep(ctx context.Context) error {
+    swept, err := s.DB.DeleteUnattachedMedia(ctx, time.Now().Add(-s.MaxAge))
+    if err != nil {
+        return err
+    }
+
+    for _, row := range swept {
+        for _, key := range []string{row.BlobKey, row.ThumbnailKey} {
+            err = s.Blobs.Delete(ctx, key)
+            if err != nil {
+                log.Printf("Failed to delete blob %s: %v", key, err)
+            }
+        }
+    }
+
+    return nil
+}
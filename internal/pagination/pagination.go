@@ -0,0 +1,139 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+    DefaultLimit = 50
+    MaxLimit = 100
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor marks a position in a list ordered by (created_at, id). Clients only
+// ever see it encoded, so its layout can change without breaking them.
+type Cursor struct {
+    CreatedAt time.Time
+    ID uuid.UUID
+}
+
+func (c Cursor) Encode() string {
+    raw := fmt.Sprintf("%d:%s", c.CreatedAt.UnixMicro(), c.ID)
+    return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return Cursor{}, ErrInvalidCursor
+    }
+
+    micros, id, ok := strings.Cut(string(raw), ":")
+    if !ok {
+        return Cursor{}, ErrInvalidCursor
+    }
+
+    unixMicro, err := strconv.ParseInt(micros, 10, 64)
+    if err != nil {
+        return Cursor{}, ErrInvalidCursor
+    }
+
+    parsedID, err := uuid.Parse(id)
+    if err != nil {
+        return Cursor{}, ErrInvalidCursor
+    }
+
+    return Cursor{
+        CreatedAt: time.UnixMicro(unixMicro).UTC(),
+        ID: parsedID,
+    }, nil
+}
+
+// RankedCursor marks a position in a list ordered by (rank, created_at, id),
+// as search results are. The rank is written with full precision so the
+// next page starts exactly where the last one ended.
+type RankedCursor struct {
+    Rank float64
+    CreatedAt time.Time
+    ID uuid.UUID
+}
+
+func (c RankedCursor) Encode() string {
+    raw := fmt.Sprintf("%s:%d:%s", strconv.FormatFloat(c.Rank, 'g', -1, 64), c.CreatedAt.UnixMicro(), c.ID)
+    return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeRankedCursor(s string) (RankedCursor, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return RankedCursor{}, ErrInvalidCursor
+    }
+
+    parts := strings.SplitN(string(raw), ":", 3)
+    if len(parts) != 3 {
+        return RankedCursor{}, ErrInvalidCursor
+    }
+
+    rank, err := strconv.ParseFloat(parts[0], 64)
+    if err != nil {
+        return RankedCursor{}, ErrInvalidCursor
+    }
+
+    unixMicro, err := strconv.ParseInt(parts[1], 10, 64)
+    if err != nil {
+        return RankedCursor{}, ErrInvalidCursor
+    }
+
+    parsedID, err := uuid.Parse(parts[2])
+    if err != nil {
+        return RankedCursor{}, ErrInvalidCursor
+    }
+
+    return RankedCursor{
+        Rank: rank,
+        CreatedAt: time.UnixMicro(unixMicro).UTC(),
+        ID: parsedID,
+    }, nil
+}
+
+// ParseLimit reads a page size, falling back to DefaultLimit when s is empty
+// and clamping to MaxLimit.
+func ParseLimit(s string) (int, error) {
+    if s == "" {
+        return DefaultLimit, nil
+    }
+
+    limit, err := strconv.Atoi(s)
+    if err != nil || limit < 1 {
+        return 0, errors.New("Limit must be a positive integer")
+    }
+
+    if limit > MaxLimit {
+        limit = MaxLimit
+    }
+
+    return limit, nil
+}
+
+// NextLink returns a Link header value pointing at the page after cursor,
+// keeping every other query parameter of u.
+func NextLink(u *url.URL, cursor string) string {
+    query := u.Query()
+    query.Set("cursor", cursor)
+
+    next := url.URL{
+        Path: u.Path,
+        RawQuery: query.Encode(),
+    }
+
+    return fmt.Sprintf("<%s>; rel=\"next\"", next.String())
+}
@@ -0,0 +1,87 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+    cursor := Cursor{
+        CreatedAt: time.Date(2025, 3, 4, 5, 6, 7, 123456000, time.UTC),
+        ID: uuid.New(),
+    }
+
+    decoded, err := DecodeCursor(cursor.Encode())
+    if err != nil {
+        t.Fatalf("Failed to decode cursor: %v", err)
+    }
+    if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+        t.Errorf("Cursor changed from %+v to %+v", cursor, decoded)
+    }
+
+    for _, bad := range []string{"", "not base64!", "bm9jb2xvbg", "YWJjOmRlZg"} {
+        _, err := DecodeCursor(bad)
+        if err == nil {
+            t.Errorf("Expected %q to be rejected", bad)
+        }
+    }
+}
+
+func TestRankedCursorRoundTrip(t *testing.T) {
+    cursor := RankedCursor{
+        Rank: 0.1 + 0.2,
+        CreatedAt: time.Date(2025, 3, 4, 5, 6, 7, 123456000, time.UTC),
+        ID: uuid.New(),
+    }
+
+    decoded, err := DecodeRankedCursor(cursor.Encode())
+    if err != nil {
+        t.Fatalf("Failed to decode cursor: %v", err)
+    }
+    if decoded.Rank != cursor.Rank || !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+        t.Errorf("Cursor changed from %+v to %+v", cursor, decoded)
+    }
+
+    plain := Cursor{CreatedAt: cursor.CreatedAt, ID: cursor.ID}.Encode()
+    for _, bad := range []string{"", "not base64!", plain} {
+        _, err := DecodeRankedCursor(bad)
+        if err == nil {
+            t.Errorf("Expected %q to be rejected", bad)
+        }
+    }
+}
+
+func TestParseLimit(t *testing.T) {
+    cases := []struct {
+        in string
+        want int
+        ok bool
+    }{
+        {"", DefaultLimit, true},
+        {"10", 10, true},
+        {"1000", MaxLimit, true},
+        {"0", 0, false},
+        {"-3", 0, false},
+        {"ten", 0, false},
+    }
+
+    for _, c := range cases {
+        got, err := ParseLimit(c.in)
+        if (err == nil) != c.ok || got != c.want {
+            t.Errorf("ParseLimit(%q) = %d, %v", c.in, got, err)
+        }
+    }
+}
+
+func TestNextLink(t *testing.T) {
+    u, _ := url.Parse("/api/chirps?author_id=abc&cursor=old&sort=desc")
+
+    got := NextLink(u, "new")
+    want := `</api/chirps?author_id=abc&cursor=new&sort=desc>; rel="next"`
+    if got != want {
+        t.Errorf("Expected %s, got %s", want, got)
+    }
+}
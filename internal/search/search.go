@@ -0,0 +1,114 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const dateLayout = "2006-01-02"
+
+// Query is a parsed search box. Text keeps the words, quoted phrases and
+// -exclusions as typed so it can go straight to websearch_to_tsquery, while
+// the operators are pulled out for the WHERE clause.
+type Query struct {
+    Text string
+    From string
+    Since time.Time
+    Until time.Time
+}
+
+// Parse splits q into free text and the from:handle, since:date and
+// until:date operators. Dates are YYYY-MM-DD or RFC 3339; a bare until date
+// includes that whole day. Operators inside quotes are plain text.
+func Parse(q string) (Query, error) {
+    query := Query{}
+    text := []string{}
+
+    for _, token := range tokenize(q) {
+        key, value, ok := strings.Cut(token, ":")
+        if !ok || strings.HasPrefix(token, "\"") || strings.HasPrefix(token, "-") {
+            text = append(text, token)
+            continue
+        }
+
+        var err error
+        switch strings.ToLower(key) {
+        case "from":
+            query.From = strings.TrimPrefix(value, "@")
+            if query.From == "" {
+                return Query{}, errors.New("Invalid from: handle")
+            }
+        case "since":
+            query.Since, _, err = parseTime(value)
+            if err != nil {
+                return Query{}, errors.New("Invalid since: date")
+            }
+        case "until":
+            var dateOnly bool
+            query.Until, dateOnly, err = parseTime(value)
+            if err != nil {
+                return Query{}, errors.New("Invalid until: date")
+            }
+            if dateOnly {
+                query.Until = query.Until.AddDate(0, 0, 1)
+            }
+        default:
+            text = append(text, token)
+        }
+    }
+
+    query.Text = strings.Join(text, " ")
+    return query, nil
+}
+
+func parseTime(value string) (time.Time, bool, error) {
+    t, err := time.Parse(dateLayout, value)
+    if err == nil {
+        return t, true, nil
+    }
+
+    t, err = time.Parse(time.RFC3339, value)
+    if err != nil {
+        return time.Time{}, false, err
+    }
+
+    return t.UTC(), false, nil
+}
+
+// tokenize splits on whitespace but keeps a quoted phrase, optionally
+// negated, as one token. An unclosed quote runs to the end of q.
+func tokenize(q string) []string {
+    tokens := []string{}
+    runes := []rune(q)
+
+    for i := 0; i < len(runes); {
+        if unicode.IsSpace(runes[i]) {
+            i++
+            continue
+        }
+
+        start := i
+        if runes[i] == '-' && i+1 < len(runes) && runes[i+1] == '"' {
+            i++
+        }
+        if runes[i] == '"' {
+            i++
+            for i < len(runes) && runes[i] != '"' {
+                i++
+            }
+            if i < len(runes) {
+                i++
+            }
+        } else {
+            for i < len(runes) && !unicode.IsSpace(runes[i]) {
+                i++
+            }
+        }
+
+        tokens = append(tokens, string(runes[start:i]))
+    }
+
+    return tokens
+}
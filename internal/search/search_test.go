@@ -0,0 +1,49 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+    cases := []struct {
+        in string
+        want Query
+    }{
+        {"", Query{}},
+        {"hello world", Query{Text: "hello world"}},
+        {`"kernel panic" -windows`, Query{Text: `"kernel panic" -windows`}},
+        {"  go   from:@alice  ", Query{Text: "go", From: "alice"}},
+        {`"from:bob" is text`, Query{Text: `"from:bob" is text`}},
+        {`-"not this" FROM:bob`, Query{Text: `-"not this"`, From: "bob"}},
+        {"since:2025-01-02 until:2025-01-03 news", Query{
+            Text: "news",
+            Since: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+            Until: time.Date(2025, 1, 4, 0, 0, 0, 0, time.UTC),
+        }},
+        {"until:2025-01-03T10:00:00+02:00", Query{
+            Until: time.Date(2025, 1, 3, 8, 0, 0, 0, time.UTC),
+        }},
+        {"https://example.com", Query{Text: "https://example.com"}},
+        {`"unclosed phrase`, Query{Text: `"unclosed phrase`}},
+    }
+
+    for _, c := range cases {
+        got, err := Parse(c.in)
+        if err != nil {
+            t.Errorf("Parse(%q) failed: %v", c.in, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, c.want) {
+            t.Errorf("Parse(%q) = %+v, want %+v", c.in, got, c.want)
+        }
+    }
+
+    for _, bad := range []string{"from:", "from:@", "since:yesterday", "until:2025-13-01"} {
+        _, err := Parse(bad)
+        if err == nil {
+            t.Errorf("Expected %q to be rejected", bad)
+        }
+    }
+}
@@ -0,0 +1,165 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+    DefaultReplaySize = 1000
+    // subscriberBuffer is how far a subscriber may fall behind before the
+    // hub drops it. Dropped clients reconnect and resume from the replay
+    // buffer.
+    subscriberBuffer = 64
+)
+
+// Event is one message on the hub. IDs increase by one per event and are
+// only meaningful to the hub that assigned them, which Epoch identifies.
+type Event struct {
+    ID uint64
+    Epoch string
+    Type string
+    AuthorID uuid.UUID
+    Data []byte
+}
+
+// Hub fans events out to every subscriber and keeps the most recent ones so
+// reconnecting clients can catch up. It is safe for concurrent use.
+type Hub struct {
+    mu sync.Mutex
+    epoch string
+    lastID uint64
+    // replay is a ring of the last replaySize events; once it is full,
+    // oldest marks where the next event overwrites.
+    replay []Event
+    oldest int
+    replaySize int
+    subscribers map[*Subscription]struct{}
+}
+
+func NewHub(replaySize int) *Hub {
+    return &Hub{
+        epoch: uuid.NewString()[:8],
+        replaySize: replaySize,
+        subscribers: map[*Subscription]struct{}{},
+    }
+}
+
+type Subscription struct {
+    // C receives events until the subscription is closed, either by Close
+    // or by the hub when the subscriber falls too far behind.
+    C <-chan Event
+    ch chan Event
+    hub *Hub
+}
+
+// Publish assigns the next ID to an event and delivers it. It never blocks
+// on a slow subscriber.
+func (h *Hub) Publish(eventType string, authorID uuid.UUID, data []byte) Event {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.lastID++
+    event := Event{
+        ID: h.lastID,
+        Epoch: h.epoch,
+        Type: eventType,
+        AuthorID: authorID,
+        Data: data,
+    }
+
+    if len(h.replay) < h.replaySize {
+        h.replay = append(h.replay, event)
+    } else if h.replaySize > 0 {
+        h.replay[h.oldest] = event
+        h.oldest = (h.oldest + 1) % h.replaySize
+    }
+
+    for sub := range h.subscribers {
+        select {
+        case sub.ch <- event:
+        default:
+            h.remove(sub)
+        }
+    }
+
+    return event
+}
+
+func (h *Hub) Subscribe() *Subscription {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    return h.add()
+}
+
+// Resume subscribes and returns the buffered events after lastEventID, as
+// written by WriteEvent, with no gap between them and what arrives on C.
+// complete is false when events after it have already left the buffer, or
+// the ID was not issued by this hub, so the client has missed something.
+func (h *Hub) Resume(lastEventID string) (sub *Subscription, missed []Event, complete bool) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    epoch, rawID, _ := strings.Cut(lastEventID, "-")
+    lastID, err := strconv.ParseUint(rawID, 10, 64)
+    if err != nil || epoch != h.epoch || lastID > h.lastID {
+        return h.add(), nil, false
+    }
+
+    complete = lastID == h.lastID || (len(h.replay) > 0 && h.replay[h.oldest].ID <= lastID + 1)
+    for i := range h.replay {
+        event := h.replay[(h.oldest + i) % len(h.replay)]
+        if event.ID > lastID {
+            missed = append(missed, event)
+        }
+    }
+
+    return h.add(), missed, complete
+}
+
+func (h *Hub) Subscribers() int {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    return len(h.subscribers)
+}
+
+func (h *Hub) add() *Subscription {
+    ch := make(chan Event, subscriberBuffer)
+    sub := &Subscription{
+        C: ch,
+        ch: ch,
+        hub: h,
+    }
+    h.subscribers[sub] = struct{}{}
+
+    return sub
+}
+
+func (h *Hub) remove(sub *Subscription) {
+    if _, ok := h.subscribers[sub]; ok {
+        delete(h.subscribers, sub)
+        close(sub.ch)
+    }
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+    s.hub.mu.Lock()
+    defer s.hub.mu.Unlock()
+
+    s.hub.remove(s)
+}
+
+// WriteEvent writes event in the text/event-stream format. Data must not
+// contain newlines, which holds for encoded JSON.
+func WriteEvent(w io.Writer, event Event) error {
+    _, err := fmt.Fprintf(w, "id: %s-%d\nevent: %s\ndata: %s\n\n", event.Epoch, event.ID, event.Type, event.Data)
+    return err
+}
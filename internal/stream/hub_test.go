@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHubPublish(t *testing.T) {
+    hub := NewHub(10)
+    a := hub.Subscribe()
+    b := hub.Subscribe()
+
+    author := uuid.New()
+    published := hub.Publish("chirp.created", author, []byte(`{"id":1}`))
+
+    for _, sub := range []*Subscription{a, b} {
+        got := <-sub.C
+        if got.ID != published.ID || got.Type != "chirp.created" || got.AuthorID != author {
+            t.Errorf("Unexpected event %+v", got)
+        }
+    }
+
+    a.Close()
+    a.Close()
+    if _, ok := <-a.C; ok {
+        t.Errorf("Expected closed subscription to be drained")
+    }
+    if hub.Subscribers() != 1 {
+        t.Errorf("Expected 1 subscriber, got %d", hub.Subscribers())
+    }
+}
+
+func TestHubResume(t *testing.T) {
+    hub := NewHub(3)
+    for i := 0; i < 5; i++ {
+        hub.Publish("chirp.created", uuid.New(), nil)
+    }
+
+    epoch := hub.epoch
+    cases := []struct {
+        lastID string
+        wantIDs []uint64
+        complete bool
+    }{
+        {epoch + "-5", nil, true},
+        {epoch + "-3", []uint64{4, 5}, true},
+        {epoch + "-2", []uint64{3, 4, 5}, true},
+        {epoch + "-1", []uint64{3, 4, 5}, false},
+        {epoch + "-9", nil, false},
+        {"otherhub-3", nil, false},
+        {"garbage", nil, false},
+    }
+
+    for _, c := range cases {
+        sub, missed, complete := hub.Resume(c.lastID)
+        ids := []uint64{}
+        for _, event := range missed {
+            ids = append(ids, event.ID)
+        }
+        if len(ids) != len(c.wantIDs) || complete != c.complete {
+            t.Errorf("Resume(%q) = %v, %v; want %v, %v", c.lastID, ids, complete, c.wantIDs, c.complete)
+        }
+        for i := range ids {
+            if ids[i] != c.wantIDs[i] {
+                t.Errorf("Resume(%q) = %v, want %v", c.lastID, ids, c.wantIDs)
+                break
+            }
+        }
+        sub.Close()
+    }
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+    hub := NewHub(0)
+    slow := hub.Subscribe()
+
+    for i := 0; i < subscriberBuffer + 1; i++ {
+        hub.Publish("chirp.created", uuid.New(), nil)
+    }
+
+    received := 0
+    for range slow.C {
+        received++
+    }
+    if received != subscriberBuffer {
+        t.Errorf("Expected %d buffered events before the drop, got %d", subscriberBuffer, received)
+    }
+    if hub.Subscribers() != 0 {
+        t.Errorf("Expected the slow subscriber to be removed")
+    }
+    slow.Close()
+}
+
+func TestHubConcurrentSubscribers(t *testing.T) {
+    hub := NewHub(DefaultReplaySize)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 50; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            sub := hub.Subscribe()
+            defer sub.Close()
+            for j := 0; j < 10; j++ {
+                hub.Publish("chirp.deleted", uuid.New(), nil)
+                select {
+                case <-sub.C:
+                default:
+                }
+            }
+        }()
+    }
+    wg.Wait()
+
+    if hub.Subscribers() != 0 {
+        t.Errorf("Expected every subscriber to be gone, got %d", hub.Subscribers())
+    }
+}
+
+func TestWriteEvent(t *testing.T) {
+    var buf bytes.Buffer
+    err := WriteEvent(&buf, Event{ID: 7, Epoch: "abc", Type: "chirp.deleted", Data: []byte(`{"id":"x"}`)})
+    if err != nil {
+        t.Fatalf("Failed to write event: %v", err)
+    }
+
+    want := "id: abc-7\nevent: chirp.deleted\ndata: {\"id\":\"x\"}\n\n"
+    if buf.String() != want {
+        t.Errorf("Got %q, want %q", buf.String(), want)
+    }
+}
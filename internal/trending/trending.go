@@ -0,0 +1,55 @@
+package trending
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/zulkou/chirpy/internal/database"
+)
+
+// Job rebuilds the trending_hashtags table on a fixed interval. A tag scores
+// the sum over its uses inside Window, each use weighted by 0.5^(age/HalfLife),
+// so a burst of recent chirps outranks a steady trickle from hours ago.
+type Job struct {
+    DB *database.Queries
+    Window time.Duration
+    HalfLife time.Duration
+    Interval time.Duration
+    Limit int
+}
+
+var (
+    DefaultWindow = 24 * time.Hour
+    DefaultHalfLife = 4 * time.Hour
+    DefaultInterval = 5 * time.Minute
+    DefaultLimit = 100
+)
+
+// Run refreshes once straight away and then every Interval until ctx is done.
+// Failures are logged and retried on the next tick.
+func (j *Job) Run(ctx context.Context) {
+    ticker := time.NewTicker(j.Interval)
+    defer ticker.Stop()
+
+    for {
+        err := j.Refresh(ctx)
+        if err != nil {
+            log.Printf("Failed to refresh trending hashtags: %v", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (j *Job) Refresh(ctx context.Context) error {
+    return j.DB.RefreshTrendingHashtags(ctx, database.RefreshTrendingHashtagsParams{
+        HalfLifeSeconds: j.HalfLife.Seconds(),
+        WindowSeconds: j.Window.Seconds(),
+        Limit: int32(j.Limit),
+    })
+}
@@ -0,0 +1,116 @@
+package trending
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zulkou/chirpy/internal/database"
+)
+
+// recordingDB stands in for Postgres and keeps every statement it is sent.
+type recordingDB struct {
+    mu sync.Mutex
+    queries []string
+    args [][]interface{}
+    err error
+}
+
+func (db *recordingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    db.queries = append(db.queries, query)
+    db.args = append(db.args, args)
+    return nil, db.err
+}
+
+func (db *recordingDB) calls() int {
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    return len(db.queries)
+}
+
+func (db *recordingDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+    return nil, errors.New("not supported")
+}
+
+func (db *recordingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    return nil, errors.New("not supported")
+}
+
+func (db *recordingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    return nil
+}
+
+func TestRefreshPassesDecayParameters(t *testing.T) {
+    db := &recordingDB{}
+    job := &Job{
+        DB: database.New(db),
+        Window: 6 * time.Hour,
+        HalfLife: 90 * time.Minute,
+        Interval: time.Minute,
+        Limit: 25,
+    }
+
+    err := job.Refresh(context.Background())
+    if err != nil {
+        t.Fatalf("Failed to refresh: %v", err)
+    }
+
+    if db.calls() != 1 {
+        t.Fatalf("Refresh() sent %d statements, want 1", db.calls())
+    }
+    if !strings.Contains(db.queries[0], "RefreshTrendingHashtags") {
+        t.Errorf("Refresh() ran %q", db.queries[0])
+    }
+
+    // $1 is the half-life and $2 the window, both in seconds, then the limit.
+    want := []interface{}{float64(5400), float64(21600), int32(25)}
+    got := db.args[0]
+    if len(got) != len(want) {
+        t.Fatalf("Refresh() args = %v, want %v", got, want)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Errorf("Refresh() arg $%d = %v (%T), want %v (%T)", i+1, got[i], got[i], want[i], want[i])
+        }
+    }
+}
+
+func TestRunRefreshesUntilCancelled(t *testing.T) {
+    db := &recordingDB{err: errors.New("database is down")}
+    job := &Job{
+        DB: database.New(db),
+        Window: DefaultWindow,
+        HalfLife: DefaultHalfLife,
+        Interval: 10 * time.Millisecond,
+        Limit: DefaultLimit,
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        job.Run(ctx)
+        close(done)
+    }()
+
+    // Failures are only logged, so the job keeps refreshing on every tick.
+    deadline := time.Now().Add(time.Second)
+    for db.calls() < 3 && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    cancel()
+
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatalf("Run() did not return after cancel")
+    }
+    if db.calls() < 3 {
+        t.Errorf("Run() refreshed %d times, want at least 3", db.calls())
+    }
+}
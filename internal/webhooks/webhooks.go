@@ -0,0 +1,182 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zulkou/chirpy/internal/auth"
+	"github.com/zulkou/chirpy/internal/events"
+)
+
+// SignatureHeader uses the same "t=...,v1=..." format Chirpy accepts on
+// inbound webhooks, so receivers verify it the way auth.VerifyWebhookSignature
+// does.
+const (
+    SignatureHeader = "X-Chirpy-Signature"
+    EventHeader = "X-Chirpy-Event"
+    DeliveryHeader = "X-Chirpy-Delivery"
+)
+
+// SecretPrefix marks webhook signing secrets so they are recognisable if they
+// leak into logs or source control.
+const SecretPrefix = "whsec_"
+
+var ErrPrivateAddress = errors.New("Webhook URL resolves to a private address")
+
+// subscribableEvents are the bus events a subscription may ask for.
+// token.revoked is left out on purpose: it exists to invalidate caches
+// inside Chirpy, not to tell third parties about sessions.
+var subscribableEvents = []string{
+    events.ChirpCreated,
+    events.ChirpDeleted,
+    events.UserUpgraded,
+}
+
+func ValidEvent(eventType string) bool {
+    return slices.Contains(subscribableEvents, eventType)
+}
+
+func MakeSecret() (string, error) {
+    secret := make([]byte, 32)
+    _, err := rand.Read(secret)
+    if err != nil {
+        return "", err
+    }
+
+    return SecretPrefix + hex.EncodeToString(secret), nil
+}
+
+// Delivery is one event on its way to one subscription. The body sent is
+// rebuilt from these fields on every attempt, so retries are byte-for-byte
+// identical and receivers can deduplicate on ID.
+type Delivery struct {
+    ID uuid.UUID
+    CreatedAt time.Time
+    EventType string
+    Payload json.RawMessage
+    URL string
+    Secret string
+}
+
+type envelope struct {
+    ID uuid.UUID `json:"id"`
+    Type string `json:"type"`
+    CreatedAt time.Time `json:"created_at"`
+    Data json.RawMessage `json:"data"`
+}
+
+// Body is the JSON document POSTed to the subscriber.
+func (d Delivery) Body() ([]byte, error) {
+    return json.Marshal(envelope{
+        ID: d.ID,
+        Type: d.EventType,
+        CreatedAt: d.CreatedAt.UTC(),
+        Data: d.Payload,
+    })
+}
+
+// Send makes one delivery attempt. It returns the response status code, or 0
+// when no response arrived, and a non-nil error unless the receiver answered
+// with a 2xx status.
+func Send(ctx context.Context, client *http.Client, d Delivery, now time.Time) (int, error) {
+    body, err := d.Body()
+    if err != nil {
+        return 0, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+    req.Header.Set(EventHeader, d.EventType)
+    req.Header.Set(DeliveryHeader, d.ID.String())
+    req.Header.Set(SignatureHeader, auth.WebhookSignatureHeader(now.Unix(), body, d.Secret))
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return resp.StatusCode, fmt.Errorf("Receiver responded with %s", resp.Status)
+    }
+    return resp.StatusCode, nil
+}
+
+var (
+    DefaultBackoffBase = 30 * time.Second
+    DefaultBackoffMax = 6 * time.Hour
+)
+
+// Backoff is how long to wait after the given failed attempt, counting from
+// 1: base, 2*base, 4*base and so on, capped at max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+    if attempt < 1 {
+        attempt = 1
+    }
+    delay := base
+    for i := 1; i < attempt; i++ {
+        delay *= 2
+        if delay >= max {
+            return max
+        }
+    }
+    if delay > max {
+        return max
+    }
+    return delay
+}
+
+// NewClient returns the HTTP client deliveries are sent with. Subscribers
+// choose the URL, so unless allowPrivate is set the client refuses to connect
+// to loopback, private and link-local addresses. The check runs on the
+// resolved address at dial time so DNS tricks and redirects can't bypass it.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+    dialer := &net.Dialer{Timeout: timeout}
+    if !allowPrivate {
+        dialer.Control = func(network, address string, c syscall.RawConn) error {
+            host, _, err := net.SplitHostPort(address)
+            if err != nil {
+                return err
+            }
+            ip := net.ParseIP(host)
+            if ip == nil || !isPublic(ip) {
+                return ErrPrivateAddress
+            }
+            return nil
+        }
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.Proxy = nil
+    transport.DialContext = dialer.DialContext
+
+    return &http.Client{
+        Timeout: timeout,
+        Transport: transport,
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+}
+
+func isPublic(ip net.IP) bool {
+    return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+        ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
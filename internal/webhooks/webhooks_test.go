@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zulkou/chirpy/internal/auth"
+)
+
+func TestSendSignsDelivery(t *testing.T) {
+    d := Delivery{
+        ID: uuid.New(),
+        CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+        EventType: "chirp.created",
+        Payload: json.RawMessage(`{"id":"abc"}`),
+        Secret: "whsec_test",
+    }
+    now := time.Unix(1714564800, 0)
+
+    var got *http.Request
+    var gotBody []byte
+    receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r
+        gotBody, _ = io.ReadAll(r.Body)
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer receiver.Close()
+    d.URL = receiver.URL
+
+    code, err := Send(context.Background(), receiver.Client(), d, now)
+    if err != nil {
+        t.Fatalf("Failed to send delivery: %v", err)
+    }
+    if code != http.StatusNoContent {
+        t.Errorf("Send() code = %d, want 204", code)
+    }
+
+    if got.Header.Get(EventHeader) != "chirp.created" || got.Header.Get(DeliveryHeader) != d.ID.String() {
+        t.Errorf("Unexpected event headers: %v", got.Header)
+    }
+    // Receivers verify deliveries exactly as Chirpy verifies inbound webhooks.
+    signature := got.Header.Get(SignatureHeader)
+    err = auth.VerifyWebhookSignature(signature, gotBody, []string{d.Secret}, now, auth.DefaultWebhookTolerance)
+    if err != nil {
+        t.Errorf("Failed to verify signature %q: %v", signature, err)
+    }
+    err = auth.VerifyWebhookSignature(signature, gotBody, []string{"other"}, now, auth.DefaultWebhookTolerance)
+    if err == nil {
+        t.Errorf("Signature verified with the wrong secret")
+    }
+
+    var body struct {
+        ID uuid.UUID `json:"id"`
+        Type string `json:"type"`
+        Data map[string]string `json:"data"`
+    }
+    err = json.Unmarshal(gotBody, &body)
+    if err != nil {
+        t.Fatalf("Failed to decode body: %v", err)
+    }
+    if body.ID != d.ID || body.Type != d.EventType || body.Data["id"] != "abc" {
+        t.Errorf("Unexpected body: %s", gotBody)
+    }
+
+    again, _ := d.Body()
+    if string(again) != string(gotBody) {
+        t.Errorf("Body() is not stable across attempts")
+    }
+}
+
+func TestSendReportsFailureStatus(t *testing.T) {
+    receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "nope", http.StatusServiceUnavailable)
+    }))
+    defer receiver.Close()
+
+    d := Delivery{ID: uuid.New(), EventType: "user.upgraded", Payload: json.RawMessage(`{}`), URL: receiver.URL}
+    code, err := Send(context.Background(), receiver.Client(), d, time.Now())
+    if err == nil || code != http.StatusServiceUnavailable {
+        t.Errorf("Send() = %d, %v, want 503 and an error", code, err)
+    }
+}
+
+func TestBackoff(t *testing.T) {
+    base, max := 30*time.Second, 10*time.Minute
+    cases := map[int]time.Duration{
+        0: 30 * time.Second,
+        1: 30 * time.Second,
+        2: time.Minute,
+        3: 2 * time.Minute,
+        5: 8 * time.Minute,
+        6: 10 * time.Minute,
+        40: 10 * time.Minute,
+    }
+    for attempt, want := range cases {
+        if got := Backoff(attempt, base, max); got != want {
+            t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+        }
+    }
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+    receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer receiver.Close()
+
+    d := Delivery{ID: uuid.New(), EventType: "chirp.deleted", Payload: json.RawMessage(`{}`), URL: receiver.URL}
+
+    _, err := Send(context.Background(), NewClient(time.Second, false), d, time.Now())
+    if !errors.Is(err, ErrPrivateAddress) {
+        t.Errorf("Send() to loopback error = %v, want ErrPrivateAddress", err)
+    }
+
+    _, err = Send(context.Background(), NewClient(time.Second, true), d, time.Now())
+    if err != nil {
+        t.Errorf("Send() with private addresses allowed: %v", err)
+    }
+}
@@ -0,0 +1,126 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zulkou/chirpy/internal/database"
+)
+
+const (
+    StatusPending = "pending"
+    StatusDelivered = "delivered"
+    StatusDead = "dead"
+)
+
+// Worker sends due deliveries from the webhook_deliveries queue. Claiming a
+// batch pushes next_attempt_at out by Lease, so several instances can run
+// workers side by side and a delivery whose worker died is picked up again
+// once its lease runs out. Failed attempts are retried with Backoff until
+// MaxAttempts, after which the delivery is marked dead.
+type Worker struct {
+    DB *database.Queries
+    Client *http.Client
+    Interval time.Duration
+    BatchSize int
+    MaxAttempts int
+    Lease time.Duration
+    BackoffBase time.Duration
+    BackoffMax time.Duration
+}
+
+var (
+    DefaultInterval = 5 * time.Second
+    DefaultBatchSize = 20
+    DefaultMaxAttempts = 8
+    DefaultTimeout = 10 * time.Second
+    DefaultLease = time.Minute
+)
+
+// Run drains the queue every Interval until ctx is done. Failures are logged
+// and retried on the next tick.
+func (wk *Worker) Run(ctx context.Context) {
+    ticker := time.NewTicker(wk.Interval)
+    defer ticker.Stop()
+
+    for {
+        err := wk.Process(ctx)
+        if err != nil {
+            log.Printf("Failed to process webhook deliveries: %v", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Process claims one batch of due deliveries and attempts each concurrently,
+// so a slow receiver doesn't hold up the rest of the batch.
+func (wk *Worker) Process(ctx context.Context) error {
+    claimed, err := wk.DB.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+        LeaseSeconds: wk.Lease.Seconds(),
+        Limit: int32(wk.BatchSize),
+    })
+    if err != nil {
+        return err
+    }
+
+    var wg sync.WaitGroup
+    for _, row := range claimed {
+        wg.Add(1)
+        go func(row database.ClaimWebhookDeliveriesRow) {
+            defer wg.Done()
+            wk.attempt(ctx, row)
+        }(row)
+    }
+    wg.Wait()
+
+    return nil
+}
+
+func (wk *Worker) attempt(ctx context.Context, row database.ClaimWebhookDeliveriesRow) {
+    delivery := Delivery{
+        ID: row.ID,
+        CreatedAt: row.CreatedAt,
+        EventType: row.EventType,
+        Payload: json.RawMessage(row.Payload),
+        URL: row.Url,
+        Secret: row.Secret,
+    }
+
+    started := time.Now()
+    code, sendErr := Send(ctx, wk.Client, delivery, started)
+    elapsed := time.Since(started)
+
+    params := database.RecordWebhookAttemptParams{
+        DeliveryID: row.ID,
+        DurationMs: int32(elapsed.Milliseconds()),
+        Status: StatusDelivered,
+    }
+    if code != 0 {
+        params.StatusCode = sql.NullInt32{Int32: int32(code), Valid: true}
+    }
+    if sendErr != nil {
+        attempts := int(row.Attempts) + 1
+        params.Error = sendErr.Error()
+        if attempts >= wk.MaxAttempts {
+            params.Status = StatusDead
+        } else {
+            params.Status = StatusPending
+            params.RetryAfterSeconds = Backoff(attempts, wk.BackoffBase, wk.BackoffMax).Seconds()
+        }
+    }
+
+    err := wk.DB.RecordWebhookAttempt(context.Background(), params)
+    if err != nil {
+        log.Printf("Failed to record webhook attempt for %v: %v", row.ID, err)
+    }
+}
@@ -1,33 +1,72 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/zulkou/chirpy/internal/auth"
 	"github.com/zulkou/chirpy/internal/database"
+	"github.com/zulkou/chirpy/internal/events"
+	"github.com/zulkou/chirpy/internal/mail"
+	"github.com/zulkou/chirpy/internal/media"
+	"github.com/zulkou/chirpy/internal/stream"
+	"github.com/zulkou/chirpy/internal/trending"
+	"github.com/zulkou/chirpy/internal/webhooks"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
     db *database.Queries
+    sqlDB *sql.DB
     platform string
-    jwtSecret string
-    polkaKey string
+    jwtKeys *auth.KeySet
+    polkaKeys []string
+    accountLockout auth.LockoutPolicy
+    ipLockout auth.LockoutPolicy
+    resetAccountLimit auth.LockoutPolicy
+    resetIPLimit auth.LockoutPolicy
+    mailer mail.Mailer
+    requireEmailVerification bool
+    bootstrapAdminEmail string
+    fanoutReadThreshold int64
+    blobs media.BlobStore
+    mediaSlots chan struct{}
+    hub *stream.Hub
+    bus events.Bus
 }
 
 func main() {
     godotenv.Load()
 
     roles := os.Getenv("PLATFORM")
-    jwtString := os.Getenv("JWT_SECRET")
-    polkaKey := os.Getenv("POLKA_KEY")
+    jwtKeysDir := os.Getenv("JWT_KEYS_DIR")
+    jwtActiveKID := os.Getenv("JWT_ACTIVE_KID")
+    // POLKA_KEYS lists every key Polka may currently sign with, separated by
+    // commas, so keys can be rotated without dropping webhooks. POLKA_KEY is
+    // still accepted as a single extra key.
+    polkaKeys := []string{}
+    for _, key := range strings.Split(os.Getenv("POLKA_KEYS"), ",") {
+        if key = strings.TrimSpace(key); key != "" {
+            polkaKeys = append(polkaKeys, key)
+        }
+    }
+    if key := os.Getenv("POLKA_KEY"); key != "" {
+        polkaKeys = append(polkaKeys, key)
+    }
+    requireEmailVerification := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+    bootstrapAdminEmail := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
 
     dbURL := os.Getenv("DB_URL")
     db, err := sql.Open("postgres", dbURL)
@@ -38,13 +77,180 @@ func main() {
     defer db.Close()
     dbQueries := database.New(db)
 
+    // The first admin is whoever signs up with BOOTSTRAP_ADMIN_EMAIL and
+    // verifies it, either here at startup or when the verification lands.
+    // This is a no-op once any admin exists.
+    if bootstrapAdminEmail != "" {
+        promoted, err := dbQueries.PromoteBootstrapAdmin(context.Background(), bootstrapAdminEmail)
+        if err != nil {
+            log.Fatalf("Failed to promote bootstrap admin: %v", err)
+            return
+        }
+        if promoted > 0 {
+            log.Printf("Promoted %s to admin", bootstrapAdminEmail)
+        }
+    }
+
+    var jwtKeys *auth.KeySet
+    if jwtKeysDir != "" {
+        jwtKeys, err = auth.LoadKeySet(jwtKeysDir, jwtActiveKID)
+    } else {
+        log.Printf("JWT_KEYS_DIR is not set, signing tokens with an ephemeral key")
+        jwtKeys, err = auth.NewEphemeralKeySet()
+    }
+    if err != nil {
+        log.Fatalf("Failed to load JWT signing keys: %v", err)
+        return
+    }
+
+    argonParams := auth.DefaultArgon2idParams
+    if v := os.Getenv("ARGON2_MEMORY_KIB"); v != "" {
+        memory, err := strconv.ParseUint(v, 10, 32)
+        if err != nil {
+            log.Fatalf("Invalid ARGON2_MEMORY_KIB: %v", err)
+        }
+        argonParams.Memory = uint32(memory)
+    }
+    if v := os.Getenv("ARGON2_ITERATIONS"); v != "" {
+        iterations, err := strconv.ParseUint(v, 10, 32)
+        if err != nil {
+            log.Fatalf("Invalid ARGON2_ITERATIONS: %v", err)
+        }
+        argonParams.Iterations = uint32(iterations)
+    }
+    if v := os.Getenv("ARGON2_PARALLELISM"); v != "" {
+        parallelism, err := strconv.ParseUint(v, 10, 8)
+        if err != nil {
+            log.Fatalf("Invalid ARGON2_PARALLELISM: %v", err)
+        }
+        argonParams.Parallelism = uint8(parallelism)
+    }
+    auth.DefaultHasher = &auth.Argon2idHasher{Params: argonParams}
+
+    mailFrom := os.Getenv("MAIL_FROM")
+    var mailer mail.Mailer
+    switch os.Getenv("MAILER") {
+    case "smtp":
+        mailer = mail.NewSMTPMailer(os.Getenv("SMTP_ADDR"), mailFrom, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+    case "file":
+        mailer = &mail.FileMailer{Dir: os.Getenv("MAIL_DIR"), From: mailFrom}
+    default:
+        mailer = &mail.LogMailer{Out: os.Stdout, From: mailFrom}
+    }
+
+    var blobs media.BlobStore
+    switch os.Getenv("MEDIA_STORE") {
+    case "s3":
+        blobs = &media.S3Store{
+            Endpoint: os.Getenv("S3_ENDPOINT"),
+            Bucket: os.Getenv("S3_BUCKET"),
+            Region: os.Getenv("S3_REGION"),
+            AccessKeyID: os.Getenv("S3_ACCESS_KEY_ID"),
+            SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+        }
+    default:
+        mediaDir := os.Getenv("MEDIA_DIR")
+        if mediaDir == "" {
+            mediaDir = "./media"
+        }
+        blobs = &media.LocalStore{Dir: mediaDir}
+    }
+
+    // Accounts with at least this many followers have their chirps read into
+    // timelines instead of written into every follower's timeline. Zero makes
+    // every account fan out on read.
+    fanoutReadThreshold := int64(10000)
+    if v := os.Getenv("TIMELINE_FANOUT_READ_THRESHOLD"); v != "" {
+        fanoutReadThreshold, err = strconv.ParseInt(v, 10, 64)
+        if err != nil {
+            log.Fatalf("Invalid TIMELINE_FANOUT_READ_THRESHOLD: %v", err)
+        }
+    }
+
     mux := http.NewServeMux()
     apiCfg := &apiConfig{
         db: dbQueries,
+        sqlDB: db,
         platform: roles,
-        jwtSecret: jwtString,
-        polkaKey: polkaKey,
+        jwtKeys: jwtKeys,
+        polkaKeys: polkaKeys,
+        accountLockout: auth.DefaultAccountLockout,
+        ipLockout: auth.DefaultIPLockout,
+        resetAccountLimit: auth.DefaultResetAccountLimit,
+        resetIPLimit: auth.DefaultResetIPLimit,
+        mailer: mailer,
+        requireEmailVerification: requireEmailVerification,
+        bootstrapAdminEmail: bootstrapAdminEmail,
+        fanoutReadThreshold: fanoutReadThreshold,
+        blobs: blobs,
+        mediaSlots: make(chan struct{}, runtime.NumCPU()),
+        hub: stream.NewHub(stream.DefaultReplaySize),
+    }
+
+    // Replicas need the Postgres bus to see each other's events; a single
+    // instance can keep them in process.
+    switch os.Getenv("EVENT_BUS") {
+    case "postgres":
+        pgBus, err := events.NewPostgresBus(db, dbURL, events.DefaultChannel, apiCfg.resolveEvent)
+        if err != nil {
+            log.Fatalf("Failed to start the event bus: %v", err)
+        }
+        defer pgBus.Close()
+        apiCfg.bus = pgBus
+    default:
+        apiCfg.bus = &events.LocalBus{}
+    }
+    apiCfg.bus.Subscribe(apiCfg.streamEvent)
+
+    trendingJob := &trending.Job{
+        DB: dbQueries,
+        Window: trending.DefaultWindow,
+        HalfLife: trending.DefaultHalfLife,
+        Interval: trending.DefaultInterval,
+        Limit: trending.DefaultLimit,
+    }
+    for name, setting := range map[string]*time.Duration{
+        "TRENDING_WINDOW": &trendingJob.Window,
+        "TRENDING_HALF_LIFE": &trendingJob.HalfLife,
+        "TRENDING_INTERVAL": &trendingJob.Interval,
+    } {
+        if v := os.Getenv(name); v != "" {
+            duration, err := time.ParseDuration(v)
+            if err != nil || duration <= 0 {
+                log.Fatalf("Invalid %s: %q", name, v)
+            }
+            *setting = duration
+        }
     }
+    go trendingJob.Run(context.Background())
+
+    mediaSweeper := &media.Sweeper{
+        DB: dbQueries,
+        Blobs: blobs,
+        MaxAge: media.DefaultUnattachedMaxAge,
+        Interval: media.DefaultSweepInterval,
+    }
+    go mediaSweeper.Run(context.Background())
+
+    // Subscribers pick the URLs deliveries go to, so only dev may send them to
+    // private addresses such as a receiver on localhost.
+    webhookWorker := &webhooks.Worker{
+        DB: dbQueries,
+        Client: webhooks.NewClient(webhooks.DefaultTimeout, roles == "dev"),
+        Interval: webhooks.DefaultInterval,
+        BatchSize: webhooks.DefaultBatchSize,
+        MaxAttempts: webhooks.DefaultMaxAttempts,
+        Lease: webhooks.DefaultLease,
+        BackoffBase: webhooks.DefaultBackoffBase,
+        BackoffMax: webhooks.DefaultBackoffMax,
+    }
+    if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+        webhookWorker.MaxAttempts, err = strconv.Atoi(v)
+        if err != nil || webhookWorker.MaxAttempts < 1 {
+            log.Fatalf("Invalid WEBHOOK_MAX_ATTEMPTS: %q", v)
+        }
+    }
+    go webhookWorker.Run(context.Background())
 
     server := &http.Server{
         Addr: ":8080",
@@ -53,23 +259,66 @@ func main() {
 
     mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir("./app")))))
 
+    mux.HandleFunc("GET /media/{key}", apiCfg.serveMediaHandler)
+
     mux.HandleFunc("GET /api/healthz", apiCfg.healthzHandler)
+    mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwksHandler)
 
     mux.HandleFunc("POST /api/login", apiCfg.loginUserHandler)
+    mux.HandleFunc("POST /api/login/2fa", apiCfg.loginTwoFactorHandler)
     mux.HandleFunc("POST /api/refresh", apiCfg.refreshTokenHandler)
     mux.HandleFunc("POST /api/revoke", apiCfg.revokeTokenHandler)
+    mux.HandleFunc("GET /api/sessions", apiCfg.getSessionsHandler)
+    mux.HandleFunc("DELETE /api/sessions/{id}", apiCfg.deleteSessionHandler)
+    mux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.revokeAllSessionsHandler)
+    mux.HandleFunc("GET /api/tokens", apiCfg.getPersonalAccessTokensHandler)
+    mux.HandleFunc("POST /api/tokens", apiCfg.createPersonalAccessTokenHandler)
+    mux.HandleFunc("DELETE /api/tokens/{id}", apiCfg.deletePersonalAccessTokenHandler)
     mux.HandleFunc("POST /api/users", apiCfg.createUserHandler)
     mux.HandleFunc("PUT /api/users", apiCfg.updateUserHandler)
+    mux.HandleFunc("GET /api/users/{handle}", apiCfg.getProfileHandler)
+    mux.HandleFunc("GET /api/users/{id}/likes", apiCfg.getUserLikesHandler)
+    mux.HandleFunc("GET /api/users/{id}/followers", apiCfg.getFollowersHandler)
+    mux.HandleFunc("GET /api/users/{id}/following", apiCfg.getFollowingHandler)
+    mux.HandleFunc("POST /api/users/{id}/follow", apiCfg.followUserHandler)
+    mux.HandleFunc("DELETE /api/users/{id}/follow", apiCfg.unfollowUserHandler)
+    mux.HandleFunc("POST /api/users/verify", apiCfg.verifyEmailHandler)
+    mux.HandleFunc("POST /api/users/2fa/setup", apiCfg.setupTwoFactorHandler)
+    mux.HandleFunc("POST /api/users/2fa/confirm", apiCfg.confirmTwoFactorHandler)
+    mux.HandleFunc("POST /api/password/forgot", apiCfg.forgotPasswordHandler)
+    mux.HandleFunc("POST /api/password/reset", apiCfg.resetPasswordHandler)
 
     mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgradeUserHandler)
+    mux.HandleFunc("GET /api/webhooks", apiCfg.getWebhooksHandler)
+    mux.HandleFunc("POST /api/webhooks", apiCfg.createWebhookHandler)
+    mux.HandleFunc("DELETE /api/webhooks/{id}", apiCfg.deleteWebhookHandler)
+    mux.HandleFunc("GET /api/webhooks/{id}/deliveries", apiCfg.getWebhookDeliveriesHandler)
 
+    mux.HandleFunc("GET /api/timeline", apiCfg.getTimelineHandler)
+    mux.HandleFunc("GET /api/stream", apiCfg.streamHandler)
+    mux.HandleFunc("GET /api/notifications", apiCfg.getNotificationsHandler)
+    mux.HandleFunc("GET /api/search", apiCfg.searchHandler)
+    mux.HandleFunc("GET /api/hashtags/trending", apiCfg.getTrendingHashtagsHandler)
+    mux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.getHashtagChirpsHandler)
+    mux.HandleFunc("POST /api/notifications/read", apiCfg.readNotificationsHandler)
+
+    mux.HandleFunc("POST /api/media", apiCfg.uploadMediaHandler)
     mux.HandleFunc("POST /api/chirps", apiCfg.createChirpHandler)
     mux.HandleFunc("GET /api/chirps", apiCfg.getChirpsHandler)
     mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirpByIDHandler)
+    mux.HandleFunc("PATCH /api/chirps/{chirpID}", apiCfg.editChirpHandler)
     mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirpByIDHandler)
+    mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.getChirpRevisionsHandler)
+    mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.getChirpThreadHandler)
+    mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.likeChirpHandler)
+    mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.unlikeChirpHandler)
+
+    mux.Handle("DELETE /api/moderation/chirps/{chirpID}", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.moderateDeleteChirpHandler)))
 
-    mux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)
-    mux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
+    mux.Handle("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.metricsHandler)))
+    mux.Handle("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.resetHandler)))
+    mux.Handle("POST /admin/users/unlock", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.unlockAccountHandler)))
+    mux.Handle("PUT /admin/users/{id}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.setUserRoleHandler)))
 
     fmt.Println("Server starting...")
     err = server.ListenAndServe()
@@ -1,22 +1,162 @@
 -- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, repost_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, repost_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
+ON CONFLICT (user_id, repost_of) WHERE repost_of IS NOT NULL AND body = '' AND deleted_at IS NULL DO NOTHING
 RETURNING *;
 
--- name: GetChirps :many
+-- name: CreateReply :one
+WITH parent AS (
+    UPDATE chirps
+    SET reply_count = reply_count + 1
+    WHERE chirps.id = sqlc.arg('parent_id') AND chirps.deleted_at IS NULL
+    RETURNING chirps.id, COALESCE(chirps.root_id, chirps.id) AS root_id
+)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, parent_id, root_id)
+SELECT gen_random_uuid(), NOW(), NOW(), sqlc.arg('body')::text, sqlc.arg('user_id')::uuid, parent.id, parent.root_id
+FROM parent
+RETURNING *;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
 WHERE id = $1;
 
--- name: DeleteChirpByID :exec
-DELETE FROM chirps
+-- name: ListChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: GetRechirp :one
+SELECT * FROM chirps
+WHERE user_id = $1 AND repost_of = $2 AND body = '' AND deleted_at IS NULL;
+
+-- name: DeleteChirpIfUnreferenced :one
+WITH deleted AS (
+    DELETE FROM chirps
+    WHERE chirps.id = $1
+      AND chirps.reply_count = 0
+      AND NOT EXISTS (
+        SELECT 1 FROM chirps AS quotes
+        WHERE quotes.repost_of = chirps.id
+          AND (quotes.body <> '' OR quotes.deleted_at IS NOT NULL)
+      )
+    RETURNING chirps.id, chirps.parent_id
+), parent AS (
+    UPDATE chirps
+    SET reply_count = chirps.reply_count - 1
+    FROM deleted
+    WHERE chirps.id = deleted.parent_id
+)
+SELECT parent_id FROM deleted;
+
+-- name: TombstoneChirp :exec
+WITH revisions AS (
+    DELETE FROM chirp_revisions
+    WHERE chirp_id = $1
+), mentions AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id = $1
+), hashtags AS (
+    DELETE FROM chirp_hashtags
+    WHERE chirp_id = $1
+), media AS (
+    DELETE FROM media_attachments
+    WHERE chirp_id = $1
+), rechirps AS (
+    DELETE FROM chirps
+    WHERE repost_of = $1 AND body = '' AND deleted_at IS NULL
+)
+UPDATE chirps
+SET body = '', updated_at = NOW(), deleted_at = NOW()
 WHERE id = $1;
+
+-- name: EditChirp :one
+WITH revision AS (
+    INSERT INTO chirp_revisions(id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, COALESCE(chirps.edited_at, chirps.created_at), NOW()
+    FROM chirps
+    WHERE chirps.id = $1
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW(), edited_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
+
+-- name: ListReplies :many
+SELECT * FROM chirps
+WHERE parent_id = sqlc.arg('parent_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, 1 AS depth
+    FROM chirps
+    WHERE chirps.parent_id = ANY(sqlc.arg('parent_ids')::uuid[])
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.parent_id = descendants.id
+    WHERE descendants.depth < sqlc.arg('max_depth')::int
+)
+SELECT * FROM chirps
+WHERE id IN (SELECT id FROM descendants)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.parent_id AS id
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT chirps.parent_id
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+    WHERE chirps.parent_id IS NOT NULL
+)
+SELECT * FROM chirps
+WHERE id IN (SELECT id FROM ancestors)
+ORDER BY created_at ASC, id ASC;
@@ -0,0 +1,16 @@
+-- name: CreateEmailVerification :one
+INSERT INTO email_verifications(id, created_at, user_id, expires_at, email)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: UseEmailVerification :one
+UPDATE email_verifications
+SET used_at = NOW()
+WHERE id = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING email;
@@ -0,0 +1,57 @@
+-- name: TagChirp :exec
+WITH tags AS (
+    INSERT INTO hashtags(id, tag, created_at)
+    SELECT gen_random_uuid(), new_tags.tag, NOW()
+    FROM unnest(sqlc.arg('tags')::text[]) AS new_tags(tag)
+    ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+    RETURNING id
+)
+INSERT INTO chirp_hashtags(chirp_id, hashtag_id, created_at)
+SELECT chirps.id, tags.id, chirps.created_at
+FROM chirps, tags
+WHERE chirps.id = sqlc.arg('chirp_id')
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: ListChirpsByHashtag :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+  AND chirps.deleted_at IS NULL
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_hashtags.created_at, chirp_hashtags.chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY chirp_hashtags.created_at DESC, chirp_hashtags.chirp_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: RefreshTrendingHashtags :exec
+WITH scores AS (
+    SELECT
+        hashtag_id,
+        SUM(POWER(0.5, EXTRACT(EPOCH FROM NOW() - created_at) / sqlc.arg('half_life_seconds')::float8)) AS score,
+        COUNT(*) AS uses
+    FROM chirp_hashtags
+    WHERE created_at > NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+    GROUP BY hashtag_id
+    ORDER BY score DESC
+    LIMIT sqlc.arg('limit')
+), upserted AS (
+    INSERT INTO trending_hashtags(hashtag_id, score, uses, computed_at)
+    SELECT hashtag_id, score, uses, NOW()
+    FROM scores
+    ON CONFLICT (hashtag_id) DO UPDATE
+    SET score = EXCLUDED.score, uses = EXCLUDED.uses, computed_at = EXCLUDED.computed_at
+    RETURNING hashtag_id
+)
+DELETE FROM trending_hashtags
+WHERE hashtag_id NOT IN (SELECT hashtag_id FROM upserted);
+
+-- name: ListTrendingHashtags :many
+SELECT hashtags.tag, trending_hashtags.score, trending_hashtags.uses, trending_hashtags.computed_at
+FROM trending_hashtags
+JOIN hashtags ON hashtags.id = trending_hashtags.hashtag_id
+ORDER BY trending_hashtags.score DESC
+LIMIT $1;
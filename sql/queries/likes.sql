@@ -0,0 +1,37 @@
+-- name: LikeChirp :execrows
+WITH inserted AS (
+    INSERT INTO chirp_likes(chirp_id, user_id, created_at)
+    VALUES ($1, $2, NOW())
+    ON CONFLICT DO NOTHING
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = chirps.like_count + 1
+FROM inserted
+WHERE chirps.id = inserted.chirp_id;
+
+-- name: UnlikeChirp :execrows
+WITH deleted AS (
+    DELETE FROM chirp_likes
+    WHERE chirp_id = $1 AND user_id = $2
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = chirps.like_count - 1
+FROM deleted
+WHERE chirps.id = deleted.chirp_id;
+
+-- name: ListLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg('user_id') AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: ListChirpsLikedByUser :many
+SELECT sqlc.embed(chirps), chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = sqlc.arg('user_id')
+  AND chirps.deleted_at IS NULL
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_likes.created_at, chirp_likes.chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY chirp_likes.created_at DESC, chirp_likes.chirp_id DESC
+LIMIT sqlc.arg('limit');
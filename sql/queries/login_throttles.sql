@@ -0,0 +1,28 @@
+-- name: RecordLoginAttempt :one
+INSERT INTO login_throttles(scope, subject, failures, last_failure_at)
+VALUES (
+    sqlc.arg('scope'),
+    sqlc.arg('subject'),
+    1,
+    NOW()
+)
+ON CONFLICT (scope, subject) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => sqlc.arg('reset_after_seconds')::float8) THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    previous_failure_at = CASE
+        WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => sqlc.arg('reset_after_seconds')::float8) THEN NULL
+        ELSE login_throttles.last_failure_at
+    END,
+    last_failure_at = NOW()
+RETURNING *;
+
+-- name: ForgiveLoginAttempt :exec
+UPDATE login_throttles
+SET failures = GREATEST(failures - 1, 0)
+WHERE scope = $1 AND subject = $2;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE scope = $1 AND subject = $2;
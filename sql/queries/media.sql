@@ -0,0 +1,35 @@
+-- name: CreateMediaAttachment :one
+INSERT INTO media_attachments(id, created_at, user_id, content_type, size_bytes, width, height, blob_key, thumbnail_key)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: ListMediaAttachmentsByIDs :many
+SELECT * FROM media_attachments
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: ListMediaAttachmentsByChirpIDs :many
+SELECT * FROM media_attachments
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: AttachMedia :execrows
+UPDATE media_attachments
+SET chirp_id = sqlc.arg('chirp_id'), position = array_position(sqlc.arg('ids')::uuid[], id)
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+  AND user_id = sqlc.arg('user_id')
+  AND chirp_id IS NULL;
+
+-- name: DeleteUnattachedMedia :many
+DELETE FROM media_attachments
+WHERE chirp_id IS NULL AND created_at < sqlc.arg('created_before')
+RETURNING blob_key, thumbnail_key;
@@ -0,0 +1,35 @@
+-- name: SearchChirps :many
+WITH matches AS (
+    SELECT chirps.id,
+        (CASE WHEN sqlc.arg('query')::text = '' THEN 0
+        ELSE ts_rank_cd(to_tsvector('english', chirps.body), websearch_to_tsquery('english', sqlc.arg('query')::text)) END)::float8 AS rank
+    FROM chirps
+    WHERE chirps.deleted_at IS NULL
+      AND chirps.body <> ''
+      AND (sqlc.arg('query')::text = '' OR to_tsvector('english', chirps.body) @@ websearch_to_tsquery('english', sqlc.arg('query')::text))
+      AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id'))
+      AND (sqlc.narg('since')::timestamp IS NULL OR chirps.created_at >= sqlc.narg('since'))
+      AND (sqlc.narg('until')::timestamp IS NULL OR chirps.created_at < sqlc.narg('until'))
+)
+SELECT sqlc.embed(chirps), matches.rank
+FROM matches
+JOIN chirps ON chirps.id = matches.id
+WHERE sqlc.narg('cursor_rank')::float8 IS NULL
+   OR (matches.rank, chirps.created_at, chirps.id) < (sqlc.narg('cursor_rank'), sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY matches.rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchUsers :many
+WITH matches AS (
+    SELECT users.id,
+        ts_rank_cd((setweight(to_tsvector('simple', users.handle), 'A') || setweight(to_tsvector('simple', users.display_name), 'B')), websearch_to_tsquery('simple', sqlc.arg('query')::text))::float8 AS rank
+    FROM users
+    WHERE (setweight(to_tsvector('simple', users.handle), 'A') || setweight(to_tsvector('simple', users.display_name), 'B')) @@ websearch_to_tsquery('simple', sqlc.arg('query')::text)
+)
+SELECT users.id, users.created_at, users.handle, users.display_name, users.avatar_url, matches.rank
+FROM matches
+JOIN users ON users.id = matches.id
+WHERE sqlc.narg('cursor_rank')::float8 IS NULL
+   OR (matches.rank, users.created_at, users.id) < (sqlc.narg('cursor_rank'), sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY matches.rank DESC, users.created_at DESC, users.id DESC
+LIMIT sqlc.arg('limit');
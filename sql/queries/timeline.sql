@@ -0,0 +1,71 @@
+-- name: FanOutChirp :exec
+INSERT INTO timeline_entries(user_id, chirp_id, author_id, created_at)
+SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE chirps.id = $1 AND NOT users.fanout_on_read
+ON CONFLICT DO NOTHING;
+
+-- name: BackfillTimeline :exec
+INSERT INTO timeline_entries(user_id, chirp_id, author_id, created_at)
+SELECT sqlc.arg('user_id')::uuid, recent.id, recent.user_id, recent.created_at
+FROM (
+    SELECT chirps.id, chirps.user_id, chirps.created_at
+    FROM chirps
+    JOIN users ON users.id = chirps.user_id
+    WHERE chirps.user_id = sqlc.arg('author_id') AND chirps.deleted_at IS NULL AND NOT users.fanout_on_read
+    ORDER BY chirps.created_at DESC, chirps.id DESC
+    LIMIT sqlc.arg('limit')
+) AS recent
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteTimelineEntriesFromAuthor :exec
+DELETE FROM timeline_entries
+WHERE user_id = $1 AND author_id = $2;
+
+-- name: SetFanoutOnRead :exec
+WITH entries AS (
+    DELETE FROM timeline_entries
+    WHERE author_id = $1
+)
+UPDATE users
+SET fanout_on_read = true, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListTimeline :many
+WITH page AS (
+    (
+        SELECT timeline_entries.chirp_id, timeline_entries.created_at
+        FROM timeline_entries
+        JOIN chirps ON chirps.id = timeline_entries.chirp_id
+        WHERE timeline_entries.user_id = sqlc.arg('user_id')
+          AND chirps.deleted_at IS NULL
+          AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+            OR (timeline_entries.created_at, timeline_entries.chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+        ORDER BY timeline_entries.created_at DESC, timeline_entries.chirp_id DESC
+        LIMIT sqlc.arg('limit')
+    )
+    UNION ALL
+    (
+        SELECT chirps.id, chirps.created_at
+        FROM chirps
+        WHERE chirps.deleted_at IS NULL
+          AND (
+            chirps.user_id = sqlc.arg('user_id')
+            OR chirps.user_id IN (
+                SELECT follows.followee_id FROM follows
+                JOIN users ON users.id = follows.followee_id
+                WHERE follows.follower_id = sqlc.arg('user_id') AND users.fanout_on_read
+            )
+          )
+          AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+            OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+        ORDER BY chirps.created_at DESC, chirps.id DESC
+        LIMIT sqlc.arg('limit')
+    )
+)
+SELECT chirps.* FROM page
+JOIN chirps ON chirps.id = page.chirp_id
+ORDER BY page.created_at DESC, page.chirp_id DESC
+LIMIT sqlc.arg('limit');
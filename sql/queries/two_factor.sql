@@ -0,0 +1,43 @@
+-- name: UpsertTOTPCredential :one
+INSERT INTO totp_credentials(user_id, created_at, updated_at, secret)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, updated_at = NOW(), last_used_step = 0
+WHERE totp_credentials.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetTOTPCredentialByUser :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: ConfirmTOTPCredential :execrows
+UPDATE totp_credentials
+SET confirmed_at = NOW(), last_used_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE totp_credentials
+SET last_used_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes(user_id, code_hash, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: DeleteRecoveryCodesByUser :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
@@ -0,0 +1,74 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions(id, created_at, updated_at, user_id, url, secret, events, all_users)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: ListWebhookSubscriptionsByUser :many
+SELECT * FROM webhook_subscriptions
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = $1 AND user_id = $2;
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries(id, created_at, subscription_id, event_type, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), webhook_subscriptions.id, sqlc.arg('event_type')::text, sqlc.arg('payload')::text, NOW()
+FROM webhook_subscriptions
+JOIN users ON users.id = webhook_subscriptions.user_id
+WHERE sqlc.arg('event_type')::text = ANY(webhook_subscriptions.events)
+  AND (webhook_subscriptions.user_id = sqlc.arg('user_id')
+    OR (webhook_subscriptions.all_users AND users.role = 'admin'));
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = NOW() + make_interval(secs => sqlc.arg('lease_seconds')::float8)
+FROM webhook_subscriptions
+WHERE webhook_subscriptions.id = webhook_deliveries.subscription_id
+  AND webhook_deliveries.id IN (
+    SELECT due.id FROM webhook_deliveries AS due
+    WHERE due.status = 'pending' AND due.next_attempt_at <= NOW()
+    ORDER BY due.next_attempt_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts, webhook_subscriptions.url, webhook_subscriptions.secret;
+
+-- name: RecordWebhookAttempt :exec
+WITH attempt AS (
+    INSERT INTO webhook_delivery_attempts(id, delivery_id, attempted_at, status_code, error, duration_ms)
+    VALUES (gen_random_uuid(), sqlc.arg('delivery_id'), NOW(), sqlc.narg('status_code'), sqlc.arg('error'), sqlc.arg('duration_ms'))
+)
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    status = sqlc.arg('status'),
+    next_attempt_at = NOW() + make_interval(secs => sqlc.arg('retry_after_seconds')::float8),
+    delivered_at = CASE WHEN sqlc.arg('status') = 'delivered' THEN NOW() END
+WHERE id = sqlc.arg('delivery_id');
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = sqlc.arg('subscription_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListWebhookAttemptsByDeliveryIDs :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = ANY(sqlc.arg('delivery_ids')::uuid[])
+ORDER BY attempted_at;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    previous_failure_at TIMESTAMP,
+    PRIMARY KEY (scope, subject)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- A chirp with repost_of set is a rechirp when its body is empty and a
+-- quote chirp otherwise.
+ALTER TABLE chirps
+ADD COLUMN repost_of UUID REFERENCES chirps ON DELETE CASCADE;
+
+CREATE INDEX chirps_repost_of_idx ON chirps (repost_of);
+CREATE UNIQUE INDEX chirps_rechirp_idx ON chirps (user_id, repost_of)
+WHERE repost_of IS NOT NULL AND body = '' AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX chirps_rechirp_idx;
+DROP INDEX chirps_repost_of_idx;
+
+ALTER TABLE chirps
+DROP COLUMN repost_of;
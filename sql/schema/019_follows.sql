@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_created_at_idx ON follows (followee_id, created_at, follower_id);
+CREATE INDEX follows_follower_id_created_at_idx ON follows (follower_id, created_at, followee_id);
+
+-- Chirps by accounts with fanout_on_read set are pulled into timelines when
+-- they are read. Everyone else's are pushed into timeline_entries when posted.
+ALTER TABLE users
+ADD COLUMN fanout_on_read BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE timeline_entries (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX timeline_entries_user_id_created_at_idx ON timeline_entries (user_id, created_at, chirp_id);
+CREATE INDEX timeline_entries_author_id_idx ON timeline_entries (author_id);
+
+-- +goose Down
+DROP TABLE timeline_entries;
+
+ALTER TABLE users
+DROP COLUMN fanout_on_read;
+
+DROP TABLE follows;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE hashtags (
+    id UUID PRIMARY KEY,
+    tag TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- created_at copies the chirp's so tag pages and trending never join chirps
+-- just to order or window by time.
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    hashtag_id UUID NOT NULL REFERENCES hashtags ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, hashtag_id)
+);
+
+CREATE INDEX chirp_hashtags_hashtag_id_created_at_idx ON chirp_hashtags (hashtag_id, created_at, chirp_id);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags (created_at);
+
+-- Written by the trending job, read by GET /api/hashtags/trending.
+CREATE TABLE trending_hashtags (
+    hashtag_id UUID PRIMARY KEY REFERENCES hashtags ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    uses INTEGER NOT NULL,
+    computed_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE trending_hashtags;
+DROP TABLE chirp_hashtags;
+DROP TABLE hashtags;
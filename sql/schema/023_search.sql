@@ -0,0 +1,16 @@
+-- +goose Up
+-- The search documents are indexed as expressions rather than stored, so
+-- they stay in step with every insert and edit without triggers and stay out
+-- of every chirp and user row that is read. Search queries must spell the
+-- expressions exactly as below to use the indexes. Handles use the simple
+-- config so they are not stemmed.
+CREATE INDEX chirps_search_idx ON chirps USING GIN (to_tsvector('english', body));
+
+CREATE INDEX users_search_idx ON users USING GIN ((
+    setweight(to_tsvector('simple', handle), 'A') ||
+    setweight(to_tsvector('simple', display_name), 'B')
+));
+
+-- +goose Down
+DROP INDEX users_search_idx;
+DROP INDEX chirps_search_idx;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Uploads start unattached and are claimed by the chirp that uses them.
+-- position orders the attachments within that chirp.
+CREATE TABLE media_attachments (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    chirp_id UUID REFERENCES chirps ON DELETE CASCADE,
+    position INTEGER,
+    content_type TEXT NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    blob_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL
+);
+
+CREATE INDEX media_attachments_chirp_id_idx ON media_attachments (chirp_id, position);
+-- Uploads never attached to a chirp are swept once they are old enough.
+CREATE INDEX media_attachments_unattached_idx ON media_attachments (created_at) WHERE chirp_id IS NULL;
+
+-- +goose Down
+DROP TABLE media_attachments;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Inbound webhook events already processed, keyed by the sender's event id,
+-- so redelivered events are acknowledged without being applied twice.
+CREATE TABLE webhook_events (
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, event_id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;